@@ -22,8 +22,14 @@ const _ = grpc.SupportPackageIsVersion7
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type ButlerClient interface {
-	CreateRoom(ctx context.Context, in *RoomNameSize, opts ...grpc.CallOption) (*RoomPort, error)
-	FindRoom(ctx context.Context, in *RoomName, opts ...grpc.CallOption) (*RoomPort, error)
+	CreateRoom(ctx context.Context, in *RoomNameSize, opts ...grpc.CallOption) (*RoomRef, error)
+	FindRoom(ctx context.Context, in *RoomName, opts ...grpc.CallOption) (*RoomRef, error)
+	ListRooms(ctx context.Context, in *ListRoomsRequest, opts ...grpc.CallOption) (*ListRoomsResponse, error)
+	WatchRooms(ctx context.Context, in *WatchRoomsRequest, opts ...grpc.CallOption) (Butler_WatchRoomsClient, error)
+	GetServerInfo(ctx context.Context, in *ServerInfoRequest, opts ...grpc.CallOption) (*ServerInfo, error)
+	Register(ctx context.Context, in *Credentials, opts ...grpc.CallOption) (*Session, error)
+	Login(ctx context.Context, in *Credentials, opts ...grpc.CallOption) (*Session, error)
+	Logout(ctx context.Context, in *LogoutRequest, opts ...grpc.CallOption) (*LogoutResponse, error)
 }
 
 type butlerClient struct {
@@ -34,8 +40,8 @@ func NewButlerClient(cc grpc.ClientConnInterface) ButlerClient {
 	return &butlerClient{cc}
 }
 
-func (c *butlerClient) CreateRoom(ctx context.Context, in *RoomNameSize, opts ...grpc.CallOption) (*RoomPort, error) {
-	out := new(RoomPort)
+func (c *butlerClient) CreateRoom(ctx context.Context, in *RoomNameSize, opts ...grpc.CallOption) (*RoomRef, error) {
+	out := new(RoomRef)
 	err := c.cc.Invoke(ctx, "/chat.Butler/CreateRoom", in, out, opts...)
 	if err != nil {
 		return nil, err
@@ -43,8 +49,8 @@ func (c *butlerClient) CreateRoom(ctx context.Context, in *RoomNameSize, opts ..
 	return out, nil
 }
 
-func (c *butlerClient) FindRoom(ctx context.Context, in *RoomName, opts ...grpc.CallOption) (*RoomPort, error) {
-	out := new(RoomPort)
+func (c *butlerClient) FindRoom(ctx context.Context, in *RoomName, opts ...grpc.CallOption) (*RoomRef, error) {
+	out := new(RoomRef)
 	err := c.cc.Invoke(ctx, "/chat.Butler/FindRoom", in, out, opts...)
 	if err != nil {
 		return nil, err
@@ -52,12 +58,95 @@ func (c *butlerClient) FindRoom(ctx context.Context, in *RoomName, opts ...grpc.
 	return out, nil
 }
 
+func (c *butlerClient) ListRooms(ctx context.Context, in *ListRoomsRequest, opts ...grpc.CallOption) (*ListRoomsResponse, error) {
+	out := new(ListRoomsResponse)
+	err := c.cc.Invoke(ctx, "/chat.Butler/ListRooms", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *butlerClient) WatchRooms(ctx context.Context, in *WatchRoomsRequest, opts ...grpc.CallOption) (Butler_WatchRoomsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Butler_ServiceDesc.Streams[0], "/chat.Butler/WatchRooms", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &butlerWatchRoomsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Butler_WatchRoomsClient interface {
+	Recv() (*RoomEvent, error)
+	grpc.ClientStream
+}
+
+type butlerWatchRoomsClient struct {
+	grpc.ClientStream
+}
+
+func (x *butlerWatchRoomsClient) Recv() (*RoomEvent, error) {
+	m := new(RoomEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *butlerClient) GetServerInfo(ctx context.Context, in *ServerInfoRequest, opts ...grpc.CallOption) (*ServerInfo, error) {
+	out := new(ServerInfo)
+	err := c.cc.Invoke(ctx, "/chat.Butler/GetServerInfo", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *butlerClient) Register(ctx context.Context, in *Credentials, opts ...grpc.CallOption) (*Session, error) {
+	out := new(Session)
+	err := c.cc.Invoke(ctx, "/chat.Butler/Register", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *butlerClient) Login(ctx context.Context, in *Credentials, opts ...grpc.CallOption) (*Session, error) {
+	out := new(Session)
+	err := c.cc.Invoke(ctx, "/chat.Butler/Login", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *butlerClient) Logout(ctx context.Context, in *LogoutRequest, opts ...grpc.CallOption) (*LogoutResponse, error) {
+	out := new(LogoutResponse)
+	err := c.cc.Invoke(ctx, "/chat.Butler/Logout", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ButlerServer is the server API for Butler service.
 // All implementations must embed UnimplementedButlerServer
 // for forward compatibility
 type ButlerServer interface {
-	CreateRoom(context.Context, *RoomNameSize) (*RoomPort, error)
-	FindRoom(context.Context, *RoomName) (*RoomPort, error)
+	CreateRoom(context.Context, *RoomNameSize) (*RoomRef, error)
+	FindRoom(context.Context, *RoomName) (*RoomRef, error)
+	ListRooms(context.Context, *ListRoomsRequest) (*ListRoomsResponse, error)
+	WatchRooms(*WatchRoomsRequest, Butler_WatchRoomsServer) error
+	GetServerInfo(context.Context, *ServerInfoRequest) (*ServerInfo, error)
+	Register(context.Context, *Credentials) (*Session, error)
+	Login(context.Context, *Credentials) (*Session, error)
+	Logout(context.Context, *LogoutRequest) (*LogoutResponse, error)
 	mustEmbedUnimplementedButlerServer()
 }
 
@@ -65,12 +154,30 @@ type ButlerServer interface {
 type UnimplementedButlerServer struct {
 }
 
-func (UnimplementedButlerServer) CreateRoom(context.Context, *RoomNameSize) (*RoomPort, error) {
+func (UnimplementedButlerServer) CreateRoom(context.Context, *RoomNameSize) (*RoomRef, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CreateRoom not implemented")
 }
-func (UnimplementedButlerServer) FindRoom(context.Context, *RoomName) (*RoomPort, error) {
+func (UnimplementedButlerServer) FindRoom(context.Context, *RoomName) (*RoomRef, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method FindRoom not implemented")
 }
+func (UnimplementedButlerServer) ListRooms(context.Context, *ListRoomsRequest) (*ListRoomsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRooms not implemented")
+}
+func (UnimplementedButlerServer) WatchRooms(*WatchRoomsRequest, Butler_WatchRoomsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchRooms not implemented")
+}
+func (UnimplementedButlerServer) GetServerInfo(context.Context, *ServerInfoRequest) (*ServerInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetServerInfo not implemented")
+}
+func (UnimplementedButlerServer) Register(context.Context, *Credentials) (*Session, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (UnimplementedButlerServer) Login(context.Context, *Credentials) (*Session, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Login not implemented")
+}
+func (UnimplementedButlerServer) Logout(context.Context, *LogoutRequest) (*LogoutResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Logout not implemented")
+}
 func (UnimplementedButlerServer) mustEmbedUnimplementedButlerServer() {}
 
 // UnsafeButlerServer may be embedded to opt out of forward compatibility for this service.
@@ -120,6 +227,117 @@ func _Butler_FindRoom_Handler(srv interface{}, ctx context.Context, dec func(int
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Butler_ListRooms_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRoomsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ButlerServer).ListRooms(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/chat.Butler/ListRooms",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ButlerServer).ListRooms(ctx, req.(*ListRoomsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Butler_WatchRooms_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRoomsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ButlerServer).WatchRooms(m, &butlerWatchRoomsServer{stream})
+}
+
+type Butler_WatchRoomsServer interface {
+	Send(*RoomEvent) error
+	grpc.ServerStream
+}
+
+type butlerWatchRoomsServer struct {
+	grpc.ServerStream
+}
+
+func (x *butlerWatchRoomsServer) Send(m *RoomEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Butler_GetServerInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ServerInfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ButlerServer).GetServerInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/chat.Butler/GetServerInfo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ButlerServer).GetServerInfo(ctx, req.(*ServerInfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Butler_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Credentials)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ButlerServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/chat.Butler/Register",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ButlerServer).Register(ctx, req.(*Credentials))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Butler_Login_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Credentials)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ButlerServer).Login(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/chat.Butler/Login",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ButlerServer).Login(ctx, req.(*Credentials))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Butler_Logout_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LogoutRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ButlerServer).Logout(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/chat.Butler/Logout",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ButlerServer).Logout(ctx, req.(*LogoutRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Butler_ServiceDesc is the grpc.ServiceDesc for Butler service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -135,7 +353,151 @@ var Butler_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "FindRoom",
 			Handler:    _Butler_FindRoom_Handler,
 		},
+		{
+			MethodName: "ListRooms",
+			Handler:    _Butler_ListRooms_Handler,
+		},
+		{
+			MethodName: "GetServerInfo",
+			Handler:    _Butler_GetServerInfo_Handler,
+		},
+		{
+			MethodName: "Register",
+			Handler:    _Butler_Register_Handler,
+		},
+		{
+			MethodName: "Login",
+			Handler:    _Butler_Login_Handler,
+		},
+		{
+			MethodName: "Logout",
+			Handler:    _Butler_Logout_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchRooms",
+			Handler:       _Butler_WatchRooms_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "butler.proto",
+}
+
+// ChatClient is the client API for Chat service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ChatClient interface {
+	Join(ctx context.Context, opts ...grpc.CallOption) (Chat_JoinClient, error)
+}
+
+type chatClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewChatClient(cc grpc.ClientConnInterface) ChatClient {
+	return &chatClient{cc}
+}
+
+func (c *chatClient) Join(ctx context.Context, opts ...grpc.CallOption) (Chat_JoinClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Chat_ServiceDesc.Streams[0], "/chat.Chat/Join", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &chatJoinClient{stream}
+	return x, nil
+}
+
+type Chat_JoinClient interface {
+	Send(*ChatClientMessage) error
+	Recv() (*ChatServerMessage, error)
+	grpc.ClientStream
+}
+
+type chatJoinClient struct {
+	grpc.ClientStream
+}
+
+func (x *chatJoinClient) Send(m *ChatClientMessage) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *chatJoinClient) Recv() (*ChatServerMessage, error) {
+	m := new(ChatServerMessage)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ChatServer is the server API for Chat service.
+// All implementations must embed UnimplementedChatServer
+// for forward compatibility
+type ChatServer interface {
+	Join(Chat_JoinServer) error
+	mustEmbedUnimplementedChatServer()
+}
+
+// UnimplementedChatServer must be embedded to have forward compatible implementations.
+type UnimplementedChatServer struct {
+}
+
+func (UnimplementedChatServer) Join(Chat_JoinServer) error {
+	return status.Errorf(codes.Unimplemented, "method Join not implemented")
+}
+func (UnimplementedChatServer) mustEmbedUnimplementedChatServer() {}
+
+// UnsafeChatServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ChatServer will
+// result in compilation errors.
+type UnsafeChatServer interface {
+	mustEmbedUnimplementedChatServer()
+}
+
+func RegisterChatServer(s grpc.ServiceRegistrar, srv ChatServer) {
+	s.RegisterService(&Chat_ServiceDesc, srv)
+}
+
+func _Chat_Join_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ChatServer).Join(&chatJoinServer{stream})
+}
+
+type Chat_JoinServer interface {
+	Send(*ChatServerMessage) error
+	Recv() (*ChatClientMessage, error)
+	grpc.ServerStream
+}
+
+type chatJoinServer struct {
+	grpc.ServerStream
+}
+
+func (x *chatJoinServer) Send(m *ChatServerMessage) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *chatJoinServer) Recv() (*ChatClientMessage, error) {
+	m := new(ChatClientMessage)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Chat_ServiceDesc is the grpc.ServiceDesc for Chat service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Chat_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "chat.Chat",
+	HandlerType: (*ChatServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Join",
+			Handler:       _Chat_Join_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "butler.proto",
 }
@@ -1,48 +1,355 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"regexp"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
 	"github.com/dimaglushkov/go-chat/api/butlerpb"
 	"github.com/dimaglushkov/go-chat/internal/server"
 )
 
-func run(port int64) error {
+// shutdownConfig tells how the server shuts down on SIGINT and SIGTERM.
+type shutdownConfig struct {
+	// notice is sent to every room.
+	notice string
+	// timeout is how long clients are given to be sent what they have
+	// queued.
+	timeout time.Duration
+}
+
+// run serves the butler on port, rooms on roomPort, roomTLSPort and wsPort
+// and metrics on metricsPort, each of them unless 0. tlsConfig secures every
+// listener but the ones on roomPort and metricsPort if set. It returns once
+// the server has shut down.
+func run(port, roomPort, roomTLSPort, wsPort, metricsPort int64, tlsConfig *tls.Config, cfg server.Config, shutdown shutdownConfig) error {
+	// rooms of a previous run are gone, their logs can be rotated before
+	// any new room starts writing
+	if err := server.RecoverLogs(cfg.Room.Log); err != nil {
+		return fmt.Errorf("error while recovering room logs: %s", err)
+	}
+
 	listener, err := net.Listen("tcp", ":"+strconv.FormatInt(port, 10))
 	if err != nil {
 		return fmt.Errorf("error while setting listener: %s", err)
 	}
 
-	butler := server.NewButler()
-	grpcServer := grpc.NewServer()
+	var registry *prometheus.Registry
+	if metricsPort != 0 {
+		registry = prometheus.NewRegistry()
+		registry.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+		cfg.Metrics = registry
+	}
+	butler := server.NewButler(cfg)
+	if err := butler.LoadAccounts(); err != nil {
+		return err
+	}
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(butler.UnaryInterceptor()),
+		grpc.StreamInterceptor(butler.StreamInterceptor()),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	grpcServer := grpc.NewServer(opts...)
 	butlerpb.RegisterButlerServer(grpcServer, &butler)
+	butlerpb.RegisterChatServer(grpcServer, &butler)
+
+	errs := make(chan error, 5)
+	var roomListeners []net.Listener
+	if roomPort != 0 {
+		roomListener, err := net.Listen("tcp", ":"+strconv.FormatInt(roomPort, 10))
+		if err != nil {
+			return fmt.Errorf("error while setting room listener: %s", err)
+		}
+		roomListeners = append(roomListeners, roomListener)
+		go func() {
+			log.Printf("starting room listener on port %d\n", roomPort)
+			if err := butler.ServeRooms(roomListener); err != nil {
+				errs <- fmt.Errorf("error while serving rooms: %s", err)
+			}
+		}()
+	}
+	if roomTLSPort != 0 {
+		roomTLSListener, err := net.Listen("tcp", ":"+strconv.FormatInt(roomTLSPort, 10))
+		if err != nil {
+			return fmt.Errorf("error while setting TLS room listener: %s", err)
+		}
+		roomListeners = append(roomListeners, roomTLSListener)
+		go func() {
+			log.Printf("starting TLS room listener on port %d\n", roomTLSPort)
+			if err := butler.ServeRoomsTLS(roomTLSListener, tlsConfig); err != nil {
+				errs <- fmt.Errorf("error while serving TLS rooms: %s", err)
+			}
+		}()
+	}
+	if cfg.Room.Log.Dir != "" && cfg.Room.Log.MaxAge > 0 {
+		go pruneLogs(cfg.Room.Log)
+	}
+	var wsServer *http.Server
+	if wsPort != 0 {
+		wsListener, err := net.Listen("tcp", ":"+strconv.FormatInt(wsPort, 10))
+		if err != nil {
+			return fmt.Errorf("error while setting websocket listener: %s", err)
+		}
+		if tlsConfig != nil {
+			wsListener = tls.NewListener(wsListener, tlsConfig)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/rooms/", butler.WebSocketHandler())
+		wsServer = &http.Server{Handler: mux}
+		go func() {
+			log.Printf("starting websocket gateway on port %d\n", wsPort)
+			if err := wsServer.Serve(wsListener); err != nil && err != http.ErrServerClosed {
+				errs <- fmt.Errorf("error while serving websocket gateway: %s", err)
+			}
+		}()
+	}
+	var metricsServer *http.Server
+	if metricsPort != 0 {
+		metricsListener, err := net.Listen("tcp", ":"+strconv.FormatInt(metricsPort, 10))
+		if err != nil {
+			return fmt.Errorf("error while setting metrics listener: %s", err)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+		metricsServer = &http.Server{Handler: mux}
+		go func() {
+			log.Printf("starting metrics endpoint on port %d\n", metricsPort)
+			if err := metricsServer.Serve(metricsListener); err != nil && err != http.ErrServerClosed {
+				errs <- fmt.Errorf("error while serving metrics: %s", err)
+			}
+		}()
+	}
+	go func() {
+		log.Printf("starting go-server-server listener on port %d\n", port)
+		if err := grpcServer.Serve(listener); err != nil {
+			errs <- fmt.Errorf("error while serving grpc server: %s", err)
+		}
+	}()
 
-	log.Printf("starting go-server-server listener on port %d\n", port)
-	if err = grpcServer.Serve(listener); err != nil {
-		return fmt.Errorf("error while serving grpc server: %s", err)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-signals:
+		log.Printf("received %s, shutting down", sig)
 	}
+	signal.Stop(signals)
 
+	// new rooms and members are turned away while the rooms drain, the
+	// listeners are only closed afterwards
+	ctx, cancel := context.WithTimeout(context.Background(), shutdown.timeout)
+	defer cancel()
+	drainErr := butler.Shutdown(ctx, shutdown.notice)
+	if drainErr != nil {
+		log.Printf("rooms did not drain within %s, closing them: %s", shutdown.timeout, drainErr)
+	}
+	for _, l := range roomListeners {
+		l.Close()
+	}
+	if wsServer != nil {
+		wsServer.Close()
+	}
+	if drainErr != nil {
+		// streams of the rooms still open would hold up GracefulStop
+		grpcServer.Stop()
+	} else {
+		grpcServer.GracefulStop()
+	}
+	// metrics are served until the very end, so the shutdown itself can be
+	// watched
+	if metricsServer != nil {
+		metricsServer.Close()
+	}
+	log.Print("server stopped")
+	return nil
+}
+
+// pruneLogs applies the room log retention policy on start and every hour
+// after that.
+func pruneLogs(cfg server.LogConfig) {
+	for {
+		if err := server.PruneLogs(cfg); err != nil {
+			log.Printf("error while pruning room logs: %s", err)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// rateFlag is a server.RateLimit given as RATE[/BURST], RATE being the
+// number of events per second.
+type rateFlag struct{ l *server.RateLimit }
+
+func (f rateFlag) String() string {
+	if f.l == nil || f.l.Rate <= 0 {
+		return "0"
+	}
+	if f.l.Burst > 0 {
+		return fmt.Sprintf("%g/%d", f.l.Rate, f.l.Burst)
+	}
+	return fmt.Sprintf("%g", f.l.Rate)
+}
+
+func (f rateFlag) Set(value string) error {
+	rate, burst := value, ""
+	if i := strings.IndexByte(value, '/'); i >= 0 {
+		rate, burst = value[:i], value[i+1:]
+	}
+	var l server.RateLimit
+	var err error
+	if l.Rate, err = strconv.ParseFloat(rate, 64); err != nil || l.Rate < 0 {
+		return fmt.Errorf("invalid rate %q", rate)
+	}
+	if burst != "" {
+		if l.Burst, err = strconv.Atoi(burst); err != nil || l.Burst < 0 {
+			return fmt.Errorf("invalid burst %q", burst)
+		}
+	}
+	*f.l = l
 	return nil
 }
 
 func main() {
 	portFlag := flag.Int64("port", 0, "port number for chat to run on")
+	roomPortFlag := flag.Int64("room-port", 0, "port number for plaintext room connections")
+	roomTLSPortFlag := flag.Int64("room-tls-port", 0, "port number for room connections secured with TLS, requires -tls-cert and -tls-key")
+	certFlag := flag.String("tls-cert", "", "PEM file with the certificate chain securing the gRPC endpoint, the TLS room port and the websocket gateway")
+	keyFlag := flag.String("tls-key", "", "PEM file with the private key of -tls-cert")
+	clientCAFlag := flag.String("client-ca", "", "PEM file with the certificates of authorities issuing client certificates, makes every client present one and join rooms under the name it is issued to")
+	wsPortFlag := flag.Int64("ws-port", 0, "port number for the websocket gateway to rooms, disabled if not set")
+	metricsPortFlag := flag.Int64("metrics-port", 0, "port number to serve Prometheus metrics on at /metrics over plain HTTP, disabled if not set")
+	var cfg server.Config
+	flag.DurationVar(&cfg.Room.JoinTimeout, "room-join-timeout", time.Minute, "close rooms nobody joins within this time after creation, 0 to keep them open")
+	flag.DurationVar(&cfg.Room.IdleTimeout, "room-idle-timeout", 0, "close rooms that have had no clients for this long, 0 to close them as soon as the last client leaves")
+	flag.IntVar(&cfg.Room.HistorySize, "room-history-size", 100, "number of messages replayed to clients joining a room, 0 to disable the history")
+	flag.DurationVar(&cfg.Room.HistoryAge, "room-history-age", 0, "maximum age of the messages replayed to clients joining a room, 0 for no limit")
+	flag.StringVar(&cfg.Room.Log.Dir, "log-dir", "", "directory to keep room logs in, disabled if not set")
+	flag.Int64Var(&cfg.Room.Log.MaxSize, "log-max-size", 10<<20, "size in bytes at which room log files are rotated, 0 to rotate only when rooms close")
+	logRetentionFlag := flag.Int("log-retention-days", 0, "delete rotated room log files older than this many days, 0 to keep them forever")
+	flag.IntVar(&cfg.Room.QueueSize, "client-queue-size", 256, "number of messages a client may fall behind before -client-overflow applies")
+	overflowFlag := flag.String("client-overflow", "drop-oldest", "what to do with clients whose queue is full, drop-oldest or disconnect")
+	flag.DurationVar(&cfg.Room.WriteTimeout, "client-write-timeout", 10*time.Second, "disconnect clients a message can't be written to within this time, 0 to wait forever")
+	flag.IntVar(&cfg.Room.MaxMessageSize, "max-message-size", 4<<10, "length in bytes of the longest message clients may send, lines over 64 KiB are always rejected")
+	limits := &cfg.Room.Limits
+	*limits = server.RateLimits{
+		Messages:   server.RateLimit{Rate: 5, Burst: 10},
+		Bytes:      server.RateLimit{Rate: 4 << 10, Burst: 16 << 10},
+		IPMessages: server.RateLimit{Rate: 20, Burst: 40},
+		IPJoins:    server.RateLimit{Rate: 0.2, Burst: 5},
+		Strikes:    5,
+		MuteFor:    30 * time.Second,
+	}
+	flag.Var(rateFlag{&limits.Messages}, "limit-messages", "messages per second each client may send, as RATE[/BURST], 0 for no limit")
+	flag.Var(rateFlag{&limits.Bytes}, "limit-bytes", "bytes per second each client may send, as RATE[/BURST], 0 for no limit")
+	flag.Var(rateFlag{&limits.IPMessages}, "limit-ip-messages", "messages per second the clients from the same IP address may send to all rooms, as RATE[/BURST], 0 for no limit")
+	flag.Var(rateFlag{&limits.IPBytes}, "limit-ip-bytes", "bytes per second the clients from the same IP address may send to all rooms, as RATE[/BURST], 0 for no limit")
+	flag.Var(rateFlag{&limits.IPJoins}, "limit-ip-joins", "joins per second to any room from the same IP address, as RATE[/BURST], 0 for no limit")
+	flag.IntVar(&limits.Strikes, "limit-strikes", limits.Strikes, "number of messages over a limit and invalid frames a client may have rejected within a minute before it is muted or disconnected, 0 to never punish clients")
+	flag.DurationVar(&limits.MuteFor, "limit-mute", limits.MuteFor, "how long flooding clients are muted for, 0 to disconnect them instead")
+	flag.IntVar(&cfg.RoomNames.MaxLength, "room-name-max-length", 32, "maximum room name length in characters")
+	namePatternFlag := flag.String("room-name-pattern", "", "regular expression room names must match, letters, digits, spaces and _.- if not set")
+	reservedNamesFlag := flag.String("room-name-reserved", "", "comma-separated list of names rooms can't be created with")
+	flag.BoolVar(&cfg.Room.RequireTickets, "require-tickets", true, "only let clients that got a join ticket from FindRoom or CreateRoom join rooms")
+	var shutdown shutdownConfig
+	flag.StringVar(&shutdown.notice, "shutdown-notice", "server shutting down", "notice sent to every room when the server shuts down on SIGINT or SIGTERM")
+	flag.DurationVar(&shutdown.timeout, "shutdown-timeout", 10*time.Second, "how long clients are given on shutdown to be sent the messages queued for them")
+	flag.StringVar(&cfg.Accounts.File, "accounts-file", "", "file to keep user accounts in, accounts are disabled if not set")
+	tokenKeyFlag := flag.String("token-key-file", "", "file with the secret session tokens are signed with, a random one valid until restart if not set")
+	flag.DurationVar(&cfg.Accounts.TokenTTL, "token-ttl", 24*time.Hour, "how long session tokens are valid for")
+	flag.BoolVar(&cfg.Accounts.NoGuests, "no-guests", false, "only let clients that have logged in join rooms, requires -accounts-file")
 	flag.Parse()
 
-	if *portFlag == 0 {
+	cfg.Room.Log.MaxAge = time.Duration(*logRetentionFlag) * 24 * time.Hour
+	switch *overflowFlag {
+	case "drop-oldest":
+		cfg.Room.Overflow = server.OverflowDropOldest
+	case "disconnect":
+		cfg.Room.Overflow = server.OverflowDisconnect
+	default:
+		log.Fatalf("invalid client overflow policy: %s", *overflowFlag)
+	}
+	if *namePatternFlag != "" {
+		// anchored so that the pattern has to match the whole name
+		pattern, err := regexp.Compile(`^(?:` + *namePatternFlag + `)$`)
+		if err != nil {
+			log.Fatalf("invalid room name pattern: %s", err)
+		}
+		cfg.RoomNames.Pattern = pattern
+	}
+	for _, name := range strings.Split(*reservedNamesFlag, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			cfg.RoomNames.Reserved = append(cfg.RoomNames.Reserved, name)
+		}
+	}
+	if *tokenKeyFlag != "" {
+		key, err := os.ReadFile(*tokenKeyFlag)
+		if err != nil {
+			log.Fatalf("error while reading token key: %s", err)
+		}
+		if cfg.Accounts.TokenKey = bytes.TrimSpace(key); len(cfg.Accounts.TokenKey) < 16 {
+			log.Fatal("token key must be at least 16 bytes long")
+		}
+	}
+	if cfg.Accounts.NoGuests && cfg.Accounts.File == "" {
+		log.Fatal("-no-guests requires -accounts-file")
+	}
+
+	if *portFlag == 0 || (*roomPortFlag == 0 && *roomTLSPortFlag == 0) {
 		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
 		flag.PrintDefaults()
 		return
 	}
 
-	if err := run(*portFlag); err != nil {
+	var tlsConfig *tls.Config
+	if *certFlag != "" || *keyFlag != "" {
+		cert, err := tls.LoadX509KeyPair(*certFlag, *keyFlag)
+		if err != nil {
+			log.Fatalf("error while loading TLS certificate: %s", err)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	} else if *roomTLSPortFlag != 0 {
+		log.Fatal("-room-tls-port requires -tls-cert and -tls-key")
+	}
+	if *clientCAFlag != "" {
+		if tlsConfig == nil {
+			log.Fatal("-client-ca requires -tls-cert and -tls-key")
+		}
+		if *roomPortFlag != 0 {
+			log.Fatal("-client-ca can't be used with the plaintext -room-port, use -room-tls-port")
+		}
+		pem, err := os.ReadFile(*clientCAFlag)
+		if err != nil {
+			log.Fatalf("error while reading client CA file: %s", err)
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+			log.Fatalf("no certificates found in client CA file %s", *clientCAFlag)
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.Room.RequireClientCerts = true
+	}
+
+	if err := run(*portFlag, *roomPortFlag, *roomTLSPortFlag, *wsPortFlag, *metricsPortFlag, tlsConfig, cfg, shutdown); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -1,13 +1,38 @@
 package main
 
 import (
+	"flag"
 	"log"
 
 	"github.com/dimaglushkov/go-chat/internal/chat"
 )
 
 func main() {
-	application := chat.New()
+	defaultConfig, err := chat.DefaultConfigPath()
+	if err != nil {
+		log.Fatal(err)
+	}
+	configFlag := flag.String("config", defaultConfig, "configuration file, keeping the CA file and the pinned server certificates")
+	caFileFlag := flag.String("ca-file", "", "PEM file with the certificates of authorities to trust for TLS connections, overrides the one in the configuration file")
+	certFlag := flag.String("cert", "", "PEM file with the client certificate to identify with to servers requiring one, overrides the one in the configuration file")
+	keyFlag := flag.String("key", "", "PEM file with the private key of -cert")
+	flag.Parse()
+
+	cfg, err := chat.LoadConfig(*configFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *caFileFlag != "" {
+		cfg.UseCAFile(*caFileFlag)
+	}
+	if (*certFlag == "") != (*keyFlag == "") {
+		log.Fatal("-cert and -key must be given together")
+	}
+	if *certFlag != "" {
+		cfg.UseClientCert(*certFlag, *keyFlag)
+	}
+
+	application := chat.New(cfg)
 	if err := application.Run(); err != nil {
 		log.Fatal(err)
 	}
@@ -1,11 +1,14 @@
 package chat
 
 import (
-	"bufio"
 	"context"
+	"crypto/tls"
+	"errors"
 	"net"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 	"unicode"
 
 	"github.com/gdamore/tcell/v2"
@@ -19,32 +22,45 @@ type Application struct {
 	tviewApp     *tview.Application
 	pages        *tview.Pages
 	pageBuilders map[string]func() tview.Primitive
+	errorModal   *tview.Modal
 	Addr         serverAddr
+	cfg          *Config
+	security     string
+	// tlsConfig secures the connections to the server, it is nil for
+	// plaintext ones.
+	tlsConfig *tls.Config
 
 	butler        butlerpb.ButlerClient
 	butlerCon     *grpc.ClientConn
-	grpcConnector func(addr, port string) (*grpc.ClientConn, error)
+	grpcConnector func(addr, port string, tlsConfig *tls.Config) (*grpc.ClientConn, error)
 
-	tcpClient    *net.TCPConn
-	tcpConnector func(addr, port string) (*net.TCPConn, error)
+	roomConn     roomConn
+	tcpConnector func(addr, port string, tlsConfig *tls.Config) (net.Conn, error)
+	transport    string
 
 	rns      butlerpb.RoomNameSize
-	roomPort *butlerpb.RoomPort
+	room     *butlerpb.RoomRef
+	roomPort string
 	action   string
 	username string
-
-	msgSender   *bufio.Writer
-	msgReceiver *bufio.Scanner
+	password string
+	// accountPassword logs in to the account called username, token is
+	// the session it gave, if any.
+	accountPassword string
+	token           string
 
 	msgChatCancel chan struct{}
 	msgRecDone    chan struct{}
 	msgLock       sync.Mutex
 	msgTable      *tview.Table
 	msgCnt        int
+	// msgReplayed tells the last printed message was replayed, so the next
+	// new one is printed below a divider.
+	msgReplayed bool
 }
 
-func New() *Application {
-	app := Application{}
+func New(cfg *Config) *Application {
+	app := Application{cfg: cfg}
 	app.grpcConnector = grpcConnector
 	app.tcpConnector = tcpConnector
 	app.msgRecDone = make(chan struct{})
@@ -61,6 +77,7 @@ func New() *Application {
 	app.pages = tview.NewPages()
 	app.pageBuilders = map[string]func() tview.Primitive{
 		"loadingPage": app.newLoadingPage,
+		"errorPage":   app.newErrorPage,
 		"addrPage":    app.newAddrPage,
 		"lobbyPage":   app.newLobbyPage,
 		"chatPage":    app.newChatPage,
@@ -98,17 +115,50 @@ func (app *Application) newAddrPage() tview.Primitive {
 		AddInputField("Port", "", 25, nil, func(text string) {
 			app.Addr.port = text
 		}).
+		AddDropDown("Transport", []string{
+			"tcp",
+			"grpc",
+		}, 0, func(opt string, optId int) {
+			app.transport = opt
+		}).
+		AddDropDown("Security", []string{
+			securityPlaintext,
+			securityTLS,
+			securityTOFU,
+		}, 0, func(opt string, optId int) {
+			app.security = opt
+		}).
 		AddButton("Submit", func() {
 			if !app.Addr.validate() {
+				app.showError(errors.New("invalid server address"), "addrPage")
 				return
 			}
 			if app.grpcConnector == nil {
 				app.stop()
 			}
 			go app.load("lobbyPage", "addrPage", func() (err error) {
-				app.butlerCon, err = app.grpcConnector(app.Addr.ipAddr, app.Addr.port)
+				app.tlsConfig, err = app.cfg.tlsConfig(app.security, app.Addr.ipAddr)
+				if err != nil {
+					return err
+				}
+				if app.tlsConfig == nil && app.cfg.hasClientCert() {
+					return errors.New("client certificates can only be used over TLS")
+				}
+				app.butlerCon, err = app.grpcConnector(app.Addr.ipAddr, app.Addr.port, app.tlsConfig)
+				if err != nil {
+					return err
+				}
 				app.butler = butlerpb.NewButlerClient(app.butlerCon)
-				return err
+				info, err := app.butler.GetServerInfo(context.Background(), &butlerpb.ServerInfoRequest{})
+				if err != nil {
+					return err
+				}
+				roomPort := info.RoomPort
+				if app.tlsConfig != nil {
+					roomPort = info.RoomTlsPort
+				}
+				app.roomPort = strconv.FormatInt(int64(roomPort), 10)
+				return nil
 			})
 		}).
 		AddButton("Quit", func() {
@@ -117,19 +167,28 @@ func (app *Application) newAddrPage() tview.Primitive {
 	addrPage.SetTitle("Server address").
 		SetBorder(true)
 
-	return center(40, 9, addrPage)
+	return center(40, 13, addrPage)
 }
 
 func (app *Application) newLobbyPage() tview.Primitive {
 	lobbyPage := tview.NewForm()
-	lobbyPage.AddInputField("user name", "", 20, func(text string, r rune) bool {
-		if len(text) > 20 {
-			return false
-		}
-		return true
-	}, func(text string) {
-		app.username = text
-	})
+	// the server takes the user name from the client certificate
+	certified := app.cfg.hasClientCert()
+	if !certified {
+		lobbyPage.AddInputField("user name", "", 20, func(text string, r rune) bool {
+			if len(text) > 20 {
+				return false
+			}
+			return true
+		}, func(text string) {
+			app.username = text
+			app.token = ""
+		})
+		lobbyPage.AddPasswordField("account password", "", 20, '*', func(text string) {
+			app.accountPassword = text
+			app.token = ""
+		})
+	}
 
 	lobbyPage.AddInputField("room name", "", 20, func(text string, r rune) bool {
 		if len(text) > 10 {
@@ -139,6 +198,9 @@ func (app *Application) newLobbyPage() tview.Primitive {
 	}, func(text string) {
 		app.rns.Name = text
 	})
+	lobbyPage.AddPasswordField("room password", "", 20, '*', func(text string) {
+		app.password = text
+	})
 	lobbyPage.AddDropDown("action", []string{
 		"join",
 		"create",
@@ -167,28 +229,13 @@ func (app *Application) newLobbyPage() tview.Primitive {
 	})
 
 	lobbyPage.AddButton("Submit", func() {
-		if app.tcpConnector == nil || len(app.username) < 2 {
-			app.stop()
-		}
-
-		var err error
-		if app.action == "create" {
-			app.roomPort, err = app.butler.CreateRoom(context.Background(), &app.rns)
-			if err != nil || app.roomPort == nil {
-				return
-			}
-		} else if app.action == "join" {
-			app.roomPort, err = app.butler.FindRoom(context.Background(), &butlerpb.RoomName{Name: app.rns.Name})
-			if err != nil || app.roomPort == nil {
-				return
-			}
-		}
-		go app.load("chatPage", "lobbyPage", func() error {
-			app.tcpClient, err = app.tcpConnector(app.Addr.ipAddr, strconv.FormatInt(int64(app.roomPort.Port), 10))
-			return err
-		})
-
+		app.enterRoom(false)
 	})
+	if !certified {
+		lobbyPage.AddButton("Register", func() {
+			app.enterRoom(true)
+		})
+	}
 	lobbyPage.AddButton("Quit", func() {
 		app.tviewApp.Stop()
 	})
@@ -196,7 +243,88 @@ func (app *Application) newLobbyPage() tview.Primitive {
 	lobbyPage.SetTitle("Connect or create a room").
 		SetBorder(true)
 
-	return center(38, 13, lobbyPage)
+	if certified {
+		return center(38, 13, lobbyPage)
+	}
+	return center(38, 17, lobbyPage)
+}
+
+// logIn gets a session for the account called app.username, registering it
+// first if register is set. Without an account password the user joins as
+// a guest.
+func (app *Application) logIn(register bool) error {
+	if app.accountPassword == "" {
+		if register {
+			return errors.New("choose an account password to register")
+		}
+		return nil
+	}
+	if app.token != "" && !register {
+		return nil
+	}
+	creds := &butlerpb.Credentials{Name: app.username, Password: app.accountPassword}
+	var sess *butlerpb.Session
+	var err error
+	if register {
+		sess, err = app.butler.Register(context.Background(), creds)
+	} else {
+		sess, err = app.butler.Login(context.Background(), creds)
+	}
+	if err != nil {
+		return err
+	}
+	app.token, app.username = sess.Token, sess.Name
+	return nil
+}
+
+// enterRoom joins or creates the room chosen in the lobby, logging in first
+// if an account password is set.
+func (app *Application) enterRoom(register bool) {
+	if app.tcpConnector == nil {
+		app.stop()
+	}
+	if len(app.username) < 2 && !app.cfg.hasClientCert() {
+		app.showError(errors.New("user name must be at least 2 characters long"), "lobbyPage")
+		return
+	}
+	if err := app.logIn(register); err != nil {
+		app.showError(err, "lobbyPage")
+		return
+	}
+
+	var err error
+	if app.action == "create" {
+		app.rns.Creator = app.username
+		app.rns.Password = app.password
+		app.room, err = app.butler.CreateRoom(context.Background(), &app.rns)
+	} else if app.action == "join" {
+		app.room, err = app.butler.FindRoom(context.Background(), &butlerpb.RoomName{Name: app.rns.Name, Password: app.password, User: app.username})
+	}
+	if err != nil {
+		app.showError(err, "lobbyPage")
+		return
+	}
+	go app.load("chatPage", "lobbyPage", func() error {
+		app.roomConn, err = app.connectRoom()
+		return err
+	})
+}
+
+func (app *Application) connectRoom() (roomConn, error) {
+	if app.transport == "grpc" {
+		return joinGRPCRoom(app.butlerCon, app.room, app.username, app.password, app.token)
+	}
+	if app.roomPort == "0" && app.tlsConfig != nil {
+		return nil, errors.New("the server has no TLS room port, use the grpc transport")
+	}
+	if app.roomPort == "0" {
+		return nil, errors.New("the server only accepts room connections over TLS")
+	}
+	conn, err := app.tcpConnector(app.Addr.ipAddr, app.roomPort, app.tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	return joinTCPRoom(conn, app.room, app.username, app.password, app.token)
 }
 
 func (app *Application) newLoadingPage() tview.Primitive {
@@ -205,6 +333,25 @@ func (app *Application) newLoadingPage() tview.Primitive {
 	return loadingPage
 }
 
+func (app *Application) newErrorPage() tview.Primitive {
+	app.errorModal = tview.NewModal().
+		AddButtons([]string{"OK"})
+	app.errorModal.SetTitle("Error").
+		SetBorder(true)
+	return app.errorModal
+}
+
+// showError displays err on the error page, which goes back to returnPageName
+// once dismissed. Must be called from the tview event loop.
+func (app *Application) showError(err error, returnPageName string) {
+	app.errorModal.
+		SetText(errorText(err)).
+		SetDoneFunc(func(int, string) {
+			app.pages.SwitchToPage(returnPageName)
+		})
+	app.pages.SwitchToPage("errorPage")
+}
+
 func (app *Application) load(nextPageName, fallbackPageName string, f func() error) {
 	app.tviewApp.QueueUpdateDraw(func() {
 		app.pages.SwitchToPage("loadingPage")
@@ -212,7 +359,7 @@ func (app *Application) load(nextPageName, fallbackPageName string, f func() err
 	err := f()
 	if err != nil {
 		app.tviewApp.QueueUpdateDraw(func() {
-			app.pages.SwitchToPage(fallbackPageName)
+			app.showError(err, fallbackPageName)
 		})
 		return
 	}
@@ -224,19 +371,40 @@ func (app *Application) load(nextPageName, fallbackPageName string, f func() err
 	})
 }
 
-func (app *Application) printMsg(msgText string) {
+func (app *Application) printMsg(msg roomMsg) {
+	cell := &tview.TableCell{Text: msg.text, Color: tcell.ColorDefault}
+	switch {
+	case msg.replayed:
+		cell.Color = tcell.ColorGray
+		cell.Attributes = tcell.AttrDim
+	case strings.HasPrefix(msg.text, systemPrefix):
+		cell.Text = strings.TrimPrefix(msg.text, systemPrefix)
+		cell.Color = tcell.ColorYellow
+		cell.Attributes = tcell.AttrItalic
+	}
+	if !msg.sentAt.IsZero() {
+		cell.Text = formatTime(msg.sentAt) + " " + cell.Text
+	}
+
 	app.msgLock.Lock()
+	if app.msgReplayed && !msg.replayed {
+		app.addMsgRow(&tview.TableCell{Text: "── new messages ──", Color: tcell.ColorGray, Align: tview.AlignCenter})
+	}
+	app.msgReplayed = msg.replayed
+	app.addMsgRow(cell)
+	app.msgLock.Unlock()
+}
+
+// addMsgRow appends cell to the message table. msgLock must be held.
+func (app *Application) addMsgRow(cell *tview.TableCell) {
+	row := app.msgCnt
 	app.tviewApp.QueueUpdateDraw(func() {
-		app.msgTable.SetCell(app.msgCnt, 0, &tview.TableCell{Text: msgText})
+		app.msgTable.SetCell(row, 0, cell)
 	})
 	app.msgCnt++
-	app.msgLock.Unlock()
 }
 
 func (app *Application) newChatPage() tview.Primitive {
-	app.msgSender = bufio.NewWriter(app.tcpClient)
-	app.msgReceiver = bufio.NewScanner(app.tcpClient)
-
 	leftSideBar := newPrimitive()
 	rightSideBar := newPrimitive()
 	msgTable := tview.NewTable()
@@ -250,11 +418,13 @@ func (app *Application) newChatPage() tview.Primitive {
 		if len(text) == 0 {
 			return
 		}
-		err := sendMsg(app.msgSender, text)
+		err := app.roomConn.sendMsg(text)
 		if err != nil {
 			return
 		}
-		go app.printMsg("me: " + text)
+		if !isCommand(text) {
+			go app.printMsg(roomMsg{text: "me: " + strings.TrimPrefix(text, "/"), sentAt: time.Now()})
+		}
 		msgInputField.SetText("")
 	})
 	msgTable.SetFocusFunc(func() {
@@ -285,20 +455,22 @@ func (app *Application) newChatPage() tview.Primitive {
 		AddItem(rightSideBar, 1, 2, 1, 1, 0, 100, false)
 
 	app.msgTable = msgTable
-	_ = sendMsg(app.msgSender, app.username)
-	go receiveMsg(app.msgReceiver, app.printMsg, app.msgRecDone)
+	go app.roomConn.receiveMsg(app.printMsg, app.msgRecDone)
 
 	return chatPage
 }
 
 func (app *Application) closeChatPage() {
-	if app.tcpClient != nil {
-		app.tcpClient.Close()
+	if app.roomConn == nil {
+		return
 	}
+	app.roomConn.Close()
+	app.roomConn = nil
 	<-app.msgRecDone
 
 	app.msgLock.Lock()
 	app.msgCnt = 0
+	app.msgReplayed = false
 	app.msgLock.Unlock()
 
 	app.pages.RemovePage("chatPage")
@@ -0,0 +1,190 @@
+package chat
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Security options of the connection to a server.
+const (
+	securityPlaintext = "plaintext"
+	// securityTLS verifies the server's certificate against the system's
+	// authorities and Config.CAFile.
+	securityTLS = "tls"
+	// securityTOFU trusts the certificate a server presents the first time
+	// and pins it, so a self-signed one can be used.
+	securityTOFU = "tls, trust on first use"
+)
+
+// Config is the client's configuration, kept in a JSON file.
+type Config struct {
+	// CAFile is a PEM file with the certificates of authorities trusted to
+	// sign server certificates, in addition to the system ones.
+	CAFile string `json:"ca_file,omitempty"`
+	// CertFile and KeyFile are PEM files with the certificate, and its
+	// private key, the client identifies itself with to the servers that
+	// require one. The server then takes the user name from it.
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// Pins maps the hosts connected to with trust on first use to the
+	// SHA-256 fingerprints of the certificates they presented first.
+	Pins map[string]string `json:"pins,omitempty"`
+
+	path string
+	// caFile overrides CAFile without being saved, see UseCAFile, certFile
+	// and keyFile override CertFile and KeyFile, see UseClientCert.
+	caFile, certFile, keyFile string
+	mu                        sync.Mutex
+}
+
+// DefaultConfigPath returns the path of the configuration file in the user's
+// configuration directory.
+func DefaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "go-chat", "config.json"), nil
+}
+
+// LoadConfig reads the configuration file at path. A missing file is an empty
+// configuration, which is written to path once there is something to keep.
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("error while reading %s: %s", path, err)
+	}
+	return cfg, nil
+}
+
+// UseCAFile makes the client trust the authorities in path instead of CAFile
+// for this run only.
+func (cfg *Config) UseCAFile(path string) {
+	cfg.caFile = path
+}
+
+// UseClientCert makes the client identify itself with the certificate in
+// certFile and the key in keyFile instead of CertFile and KeyFile for this run
+// only.
+func (cfg *Config) UseClientCert(certFile, keyFile string) {
+	cfg.certFile, cfg.keyFile = certFile, keyFile
+}
+
+// clientCertFiles returns the files of the client certificate and its key,
+// empty if the client has none.
+func (cfg *Config) clientCertFiles() (certFile, keyFile string) {
+	if cfg.certFile != "" {
+		return cfg.certFile, cfg.keyFile
+	}
+	return cfg.CertFile, cfg.KeyFile
+}
+
+// hasClientCert tells whether the client identifies itself with a
+// certificate, and so has no user name to choose.
+func (cfg *Config) hasClientCert() bool {
+	certFile, _ := cfg.clientCertFiles()
+	return certFile != ""
+}
+
+// save writes the configuration back to its file. mu must be held.
+func (cfg *Config) save() error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(cfg.path, append(data, '\n'), 0o600)
+}
+
+// tlsConfig returns the TLS configuration to connect to host with, nil for
+// plaintext connections.
+func (cfg *Config) tlsConfig(security, host string) (*tls.Config, error) {
+	var certs []tls.Certificate
+	if security != securityPlaintext && cfg.hasClientCert() {
+		cert, err := tls.LoadX509KeyPair(cfg.clientCertFiles())
+		if err != nil {
+			return nil, fmt.Errorf("error while loading client certificate: %s", err)
+		}
+		certs = append(certs, cert)
+	}
+	switch security {
+	case securityTLS:
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		caFile := cfg.CAFile
+		if cfg.caFile != "" {
+			caFile = cfg.caFile
+		}
+		if caFile != "" {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				return nil, fmt.Errorf("error while reading CA file: %s", err)
+			}
+			if !roots.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+			}
+		}
+		return &tls.Config{RootCAs: roots, Certificates: certs, MinVersion: tls.VersionTLS12}, nil
+	case securityTOFU:
+		return &tls.Config{
+			// the certificate is checked against the pin instead
+			InsecureSkipVerify: true,
+			VerifyConnection: func(cs tls.ConnectionState) error {
+				return cfg.checkPin(host, cs.PeerCertificates[0])
+			},
+			Certificates: certs,
+			MinVersion:   tls.VersionTLS12,
+		}, nil
+	}
+	return nil, nil
+}
+
+// fingerprint identifies a certificate.
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// checkPin accepts cert if it is the one pinned for host. The first
+// certificate seen for a host gets pinned.
+func (cfg *Config) checkPin(host string, cert *x509.Certificate) error {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	got := fingerprint(cert)
+	pinned, ok := cfg.Pins[host]
+	if ok {
+		if pinned != got {
+			return fmt.Errorf("certificate of %s has changed: pinned SHA-256 fingerprint is %s, the server presented %s. "+
+				"Remove the pin from %s if the change is expected", host, pinned, got, cfg.path)
+		}
+		return nil
+	}
+	if cfg.Pins == nil {
+		cfg.Pins = make(map[string]string)
+	}
+	cfg.Pins[host] = got
+	if err := cfg.save(); err != nil {
+		delete(cfg.Pins, host)
+		return fmt.Errorf("error while pinning the certificate of %s: %s", host, err)
+	}
+	return nil
+}
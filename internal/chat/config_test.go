@@ -0,0 +1,131 @@
+package chat
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCert generates a self-signed certificate for 127.0.0.1.
+func newTestCert(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "go-chat test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// handshake connects a client with config to a server presenting cert.
+func handshake(t *testing.T, config *tls.Config, cert tls.Certificate) error {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	server := tls.Server(serverConn, &tls.Config{Certificates: []tls.Certificate{cert}})
+	go func() {
+		server.Handshake()
+		serverConn.Close()
+	}()
+	config = config.Clone()
+	config.ServerName = "127.0.0.1"
+	return tls.Client(clientConn, config).Handshake()
+}
+
+func TestConfig_TrustOnFirstUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "go-chat", "config.json")
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	first, second := newTestCert(t), newTestCert(t)
+
+	config, err := cfg.tlsConfig(securityTOFU, "127.0.0.1")
+	require.NoError(t, err)
+	require.NoError(t, handshake(t, config, first))
+	require.NoError(t, handshake(t, config, first))
+	assert.Error(t, handshake(t, config, second), "changed certificate must be rejected")
+
+	// the pin survives restarts
+	cfg, err = LoadConfig(path)
+	require.NoError(t, err)
+	assert.Len(t, cfg.Pins, 1)
+	config, err = cfg.tlsConfig(securityTOFU, "127.0.0.1")
+	require.NoError(t, err)
+	assert.NoError(t, handshake(t, config, first))
+	err = handshake(t, config, second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "certificate of 127.0.0.1 has changed")
+
+	// pins are kept per host
+	config, err = cfg.tlsConfig(securityTOFU, "localhost")
+	require.NoError(t, err)
+	assert.NoError(t, handshake(t, config, second))
+}
+
+func TestConfig_CAFile(t *testing.T) {
+	cert, other := newTestCert(t), newTestCert(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600))
+
+	cfg := &Config{CAFile: caFile}
+	config, err := cfg.tlsConfig(securityTLS, "127.0.0.1")
+	require.NoError(t, err)
+	assert.NoError(t, handshake(t, config, cert))
+	assert.Error(t, handshake(t, config, other))
+
+	cfg.UseCAFile(filepath.Join(t.TempDir(), "missing.pem"))
+	_, err = cfg.tlsConfig(securityTLS, "127.0.0.1")
+	assert.Error(t, err)
+
+	config, err = cfg.tlsConfig(securityPlaintext, "127.0.0.1")
+	assert.NoError(t, err)
+	assert.Nil(t, config)
+}
+
+func TestConfig_ClientCert(t *testing.T) {
+	cert := newTestCert(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600))
+	der, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	cfg := &Config{}
+	assert.False(t, cfg.hasClientCert())
+	cfg.UseClientCert(certFile, keyFile)
+	assert.True(t, cfg.hasClientCert())
+	for _, security := range []string{securityTLS, securityTOFU} {
+		config, err := cfg.tlsConfig(security, "127.0.0.1")
+		require.NoError(t, err)
+		require.Len(t, config.Certificates, 1)
+		assert.Equal(t, cert.Certificate[0], config.Certificates[0].Certificate[0])
+	}
+	config, err := cfg.tlsConfig(securityPlaintext, "127.0.0.1")
+	assert.NoError(t, err)
+	assert.Nil(t, config)
+
+	cfg.UseClientCert(certFile, filepath.Join(dir, "missing.pem"))
+	_, err = cfg.tlsConfig(securityTLS, "127.0.0.1")
+	assert.Error(t, err)
+}
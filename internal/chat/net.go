@@ -1,17 +1,84 @@
 package chat
 
 import (
-	"bufio"
+	"context"
+	"crypto/tls"
 	"errors"
-	"log"
+	"fmt"
+	"io"
 	"net"
 	"strconv"
+	"strings"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/dimaglushkov/go-chat/api/butlerpb"
+	"github.com/dimaglushkov/go-chat/internal/wire"
 )
 
+// roomConn is a connection to a chat room over one of the supported transports.
+type roomConn interface {
+	sendMsg(msg string) error
+	// receiveMsg prints incoming messages until the connection is closed
+	// and then signals done.
+	receiveMsg(printer func(roomMsg), done chan<- struct{})
+	Close() error
+}
+
+// roomMsg is a message received from a room, rendered for the message table.
+type roomMsg struct {
+	text string
+	// replayed messages were sent to the room before we joined it.
+	replayed bool
+	// sentAt is the time the room sent the message at, if known.
+	sentAt time.Time
+}
+
+// sequence follows the sequence numbers the room stamps the messages sent to
+// all of its clients with.
+type sequence struct {
+	last uint64
+}
+
+// next takes the sequence number of a message received live, if it has one,
+// and tells how many messages were missed right before it and whether it has
+// been received already.
+func (s *sequence) next(seq uint64) (missed uint64, seen bool) {
+	if seq == 0 {
+		return 0, false
+	}
+	if s.last != 0 {
+		if seq <= s.last {
+			return 0, true
+		}
+		missed = seq - s.last - 1
+	}
+	s.last = seq
+	return missed, false
+}
+
+// deliver prints msg unless it has been received already, preceded by a notice
+// of the messages missed before it. Acks are only tracked, as the room doesn't
+// send our own messages back. Replayed messages aren't tracked, as the
+// history has gaps where joins and leaves were.
+func (s *sequence) deliver(printer func(roomMsg), msg roomMsg, seq uint64, ack bool) {
+	if !msg.replayed {
+		missed, seen := s.next(seq)
+		if seen {
+			return
+		}
+		if missed > 0 {
+			printer(roomMsg{text: fmt.Sprintf("%s%d message(s) missed", systemPrefix, missed), sentAt: msg.sentAt})
+		}
+	}
+	if !ack {
+		printer(msg)
+	}
+}
+
 type serverAddr struct {
 	ipAddr, port string
 }
@@ -26,11 +93,19 @@ func (addr serverAddr) validate() bool {
 	return true
 }
 
-func grpcConnector(addr, port string) (*grpc.ClientConn, error) {
+// grpcConnector connects to the butler, over TLS if tlsConfig is set.
+func grpcConnector(addr, port string, tlsConfig *tls.Config) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
 	var conn *grpc.ClientConn
 	conn, err := grpc.Dial(addr+":"+port,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTransportCredentials(creds),
 		grpc.WithBlock(),
+		// report a rejected certificate rather than a timeout
+		grpc.WithReturnConnectionError(),
+		grpc.FailOnNonTempDialError(true),
 		grpc.WithTimeout(time.Second*3))
 	if err != nil {
 		return nil, err
@@ -38,7 +113,11 @@ func grpcConnector(addr, port string) (*grpc.ClientConn, error) {
 	return conn, nil
 }
 
-func tcpConnector(addr, port string) (*net.TCPConn, error) {
+// tcpConnector connects to the room port, over TLS if tlsConfig is set.
+func tcpConnector(addr, port string, tlsConfig *tls.Config) (net.Conn, error) {
+	if tlsConfig != nil {
+		return tls.Dial("tcp", addr+":"+port, tlsConfig)
+	}
 	tcpAddr, _ := net.ResolveTCPAddr("tcp", addr+":"+port)
 	conn, err := net.DialTCP("tcp", nil, tcpAddr)
 
@@ -48,32 +127,191 @@ func tcpConnector(addr, port string) (*net.TCPConn, error) {
 	return conn, nil
 }
 
-func sendMsg(sender *bufio.Writer, msg string) error {
-	if sender == nil {
-		return errors.New("chat.msgSender is nil")
+// tcpRoomConn talks to a room over the framed protocol of the room port.
+type tcpRoomConn struct {
+	conn     net.Conn
+	receiver *wire.Reader
+	// members lists the room's clients as of our join, they are printed
+	// first.
+	members []string
+	seq     sequence
+	// refs numbers the messages we send, so that they get acked.
+	refs uint64
+}
+
+func joinTCPRoom(conn net.Conn, room *butlerpb.RoomRef, username, password, token string) (*tcpRoomConn, error) {
+	c := &tcpRoomConn{
+		conn:     conn,
+		receiver: wire.NewReader(conn),
+	}
+	err := wire.Write(conn, &wire.Frame{
+		Type:     wire.TypeHello,
+		Version:  wire.Version,
+		Room:     room.Id,
+		Name:     username,
+		Password: password,
+		Token:    token,
+		Ticket:   room.Ticket,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// the room answers with its own hello and then either a presence frame
+	// once we have joined or an error telling why we haven't
+	for {
+		f, err := c.receiver.Read()
+		if err != nil {
+			conn.Close()
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("room closed the connection")
+			}
+			return nil, err
+		}
+		switch f.Type {
+		case wire.TypeError:
+			conn.Close()
+			return nil, errors.New(f.Text)
+		case wire.TypePresence:
+			c.members = f.Members
+			return c, nil
+		}
 	}
+}
+
+func (c *tcpRoomConn) sendMsg(msg string) error {
 	if len(msg) == 0 {
 		return errors.New("msg is empty")
 	}
-	if msg[len(msg)-1] != '\n' {
-		msg += "\n"
+	c.refs++
+	return wire.Write(c.conn, &wire.Frame{Type: wire.TypeChat, Text: msg, Ref: strconv.FormatUint(c.refs, 10)})
+}
+
+func (c *tcpRoomConn) receiveMsg(printer func(roomMsg), done chan<- struct{}) {
+	printer(roomMsg{text: systemPrefix + "in the room: " + strings.Join(c.members, ", ")})
+	for {
+		f, err := c.receiver.Read()
+		var invalid *wire.InvalidFrameError
+		if errors.As(err, &invalid) {
+			continue
+		}
+		if err != nil {
+			break
+		}
+		if msg, ok := formatFrame(f); ok {
+			c.seq.deliver(printer, msg, f.Seq, f.Type == wire.TypeAck)
+		}
+	}
+	done <- struct{}{}
+}
+
+// formatFrame renders a frame sent by the room the way the message table
+// shows it. Frames that are neither shown nor tracked are reported with false.
+func formatFrame(f *wire.Frame) (roomMsg, bool) {
+	msg := roomMsg{replayed: f.Replayed}
+	if f.Time != 0 {
+		msg.sentAt = time.Unix(0, f.Time*int64(time.Millisecond))
+	}
+	switch f.Type {
+	case wire.TypeChat:
+		msg.text = f.Text
+		if f.Sender != "" {
+			msg.text = f.Sender + ": " + f.Text
+		}
+	case wire.TypeSystem, wire.TypeError:
+		msg.text = systemPrefix + f.Text
+	case wire.TypeJoin:
+		msg.text = f.Name + " joined"
+	case wire.TypeLeave:
+		msg.text = f.Name + " left"
+	case wire.TypeAck:
+	default:
+		return roomMsg{}, false
+	}
+	return msg, true
+}
+
+func (c *tcpRoomConn) Close() error {
+	return c.conn.Close()
+}
+
+// grpcRoomConn talks to a room over the Chat.Join stream of the connection
+// already opened to the butler.
+type grpcRoomConn struct {
+	stream butlerpb.Chat_JoinClient
+	cancel context.CancelFunc
+	// first is the message received while waiting to be admitted to the room.
+	first *butlerpb.ChatServerMessage
+	seq   sequence
+	refs  uint64
+}
+
+func joinGRPCRoom(conn *grpc.ClientConn, room *butlerpb.RoomRef, username, password, token string) (*grpcRoomConn, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := butlerpb.NewChatClient(conn).Join(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	err = stream.Send(&butlerpb.ChatClientMessage{Payload: &butlerpb.ChatClientMessage_Join{Join: &butlerpb.ChatJoin{
+		RoomId:   room.Id,
+		Name:     username,
+		Password: password,
+		Token:    token,
+		Ticket:   room.Ticket,
+	}}})
+	if err != nil {
+		cancel()
+		return nil, err
 	}
-	_, err := sender.WriteString(msg)
+	// a rejected join ends the stream with the reason as its status
+	first, err := stream.Recv()
 	if err != nil {
-		return err
+		cancel()
+		return nil, err
 	}
-	err = sender.Flush()
-	return err
+	return &grpcRoomConn{stream: stream, cancel: cancel, first: first}, nil
 }
 
-func receiveMsg(receiver *bufio.Scanner, printer func(string), done chan<- struct{}) {
-	if receiver == nil {
-		log.Println("receiver is nil")
-		return
+func (c *grpcRoomConn) sendMsg(msg string) error {
+	if len(msg) == 0 {
+		return errors.New("msg is empty")
 	}
-	for receiver.Scan() {
-		msgText := receiver.Text()
-		printer(msgText)
+	c.refs++
+	return c.stream.Send(&butlerpb.ChatClientMessage{
+		Payload: &butlerpb.ChatClientMessage_Text{Text: msg},
+		Ref:     strconv.FormatUint(c.refs, 10),
+	})
+}
+
+func (c *grpcRoomConn) receiveMsg(printer func(roomMsg), done chan<- struct{}) {
+	msg := c.first
+	for {
+		c.seq.deliver(printer, formatServerMsg(msg), msg.Seq, msg.AckRef != "")
+		var err error
+		if msg, err = c.stream.Recv(); err != nil {
+			break
+		}
 	}
 	done <- struct{}{}
 }
+
+func formatServerMsg(msg *butlerpb.ChatServerMessage) roomMsg {
+	out := roomMsg{text: msg.Text, replayed: msg.Replayed}
+	if msg.SentAt != nil {
+		out.sentAt = msg.SentAt.AsTime()
+	}
+	switch {
+	case msg.System:
+		out.text = systemPrefix + msg.Text
+	case msg.Sender != "":
+		out.text = msg.Sender + ": " + msg.Text
+	}
+	return out
+}
+
+func (c *grpcRoomConn) Close() error {
+	c.cancel()
+	return nil
+}
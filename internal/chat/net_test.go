@@ -0,0 +1,100 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dimaglushkov/go-chat/internal/wire"
+)
+
+func TestSequence_Next(t *testing.T) {
+	type step struct {
+		seq    uint64
+		missed uint64
+		seen   bool
+	}
+	testCases := []struct {
+		name  string
+		steps []step
+	}{
+		{"in order", []step{{1, 0, false}, {2, 0, false}, {3, 0, false}}},
+		// every connection starts following the room wherever it is
+		{"reset", []step{{41, 0, false}, {42, 0, false}}},
+		{"duplicate", []step{{1, 0, false}, {2, 0, false}, {2, 0, true}, {1, 0, true}, {3, 0, false}}},
+		{"gap", []step{{1, 0, false}, {4, 2, false}, {5, 0, false}, {9, 3, false}}},
+		{"unstamped", []step{{1, 0, false}, {0, 0, false}, {0, 0, false}, {2, 0, false}}},
+		{"unstamped first", []step{{0, 0, false}, {7, 0, false}, {8, 0, false}}},
+	}
+
+	for _, tc := range testCases {
+		var s sequence
+		for i, st := range tc.steps {
+			missed, seen := s.next(st.seq)
+			assert.Equal(t, st.missed, missed, "%s: step %d", tc.name, i)
+			assert.Equal(t, st.seen, seen, "%s: step %d", tc.name, i)
+		}
+	}
+}
+
+func TestSequence_Deliver(t *testing.T) {
+	sentAt := time.Now()
+	testCases := []struct {
+		name     string
+		msg      roomMsg
+		seq      uint64
+		ack      bool
+		expected []string
+	}{
+		{"next", roomMsg{text: "alice: hi", sentAt: sentAt}, 11, false, []string{"alice: hi"}},
+		{"duplicate", roomMsg{text: "alice: hi again"}, 10, false, nil},
+		{"gap", roomMsg{text: "bob: hello", sentAt: sentAt}, 14, false, []string{"*** 2 message(s) missed", "bob: hello"}},
+		{"ack", roomMsg{}, 15, true, nil},
+		{"gap before ack", roomMsg{sentAt: sentAt}, 17, true, []string{"*** 1 message(s) missed"}},
+		{"replayed", roomMsg{text: "carol: old news", replayed: true}, 3, false, []string{"carol: old news"}},
+		{"unstamped", roomMsg{text: "*** 1 in the room: alice"}, 0, false, []string{"*** 1 in the room: alice"}},
+	}
+
+	// the room is at 10 when we start following it
+	s := sequence{last: 10}
+	for _, tc := range testCases {
+		var printed []string
+		s.deliver(func(msg roomMsg) {
+			printed = append(printed, msg.text)
+			assert.Equal(t, tc.msg.sentAt, msg.sentAt, tc.name)
+		}, tc.msg, tc.seq, tc.ack)
+		assert.Equal(t, tc.expected, printed, tc.name)
+	}
+	assert.Equal(t, uint64(17), s.last, "replayed and unstamped messages aren't tracked")
+}
+
+func TestFormatFrame(t *testing.T) {
+	sentAt := time.Date(2022, 3, 8, 12, 30, 0, 0, time.UTC)
+	millis := sentAt.UnixMilli()
+	testCases := []struct {
+		frame    wire.Frame
+		expected roomMsg
+		shown    bool
+	}{
+		{wire.Frame{Type: wire.TypeChat, Sender: "alice", Text: "hi", Time: millis}, roomMsg{text: "alice: hi", sentAt: sentAt}, true},
+		{wire.Frame{Type: wire.TypeChat, Text: "* alice waves"}, roomMsg{text: "* alice waves"}, true},
+		{wire.Frame{Type: wire.TypeChat, Sender: "bob", Text: "old", Replayed: true}, roomMsg{text: "bob: old", replayed: true}, true},
+		{wire.Frame{Type: wire.TypeSystem, Text: "topic is lunch"}, roomMsg{text: "*** topic is lunch"}, true},
+		{wire.Frame{Type: wire.TypeError, Code: "InvalidArgument", Text: "invalid text"}, roomMsg{text: "*** invalid text"}, true},
+		{wire.Frame{Type: wire.TypeJoin, Name: "carol", Time: millis}, roomMsg{text: "carol joined", sentAt: sentAt}, true},
+		{wire.Frame{Type: wire.TypeLeave, Name: "carol"}, roomMsg{text: "carol left"}, true},
+		{wire.Frame{Type: wire.TypeAck, Ref: "1", Time: millis}, roomMsg{sentAt: sentAt}, true},
+		{wire.Frame{Type: wire.TypeHello, Version: wire.Version}, roomMsg{}, false},
+		{wire.Frame{Type: wire.TypePresence, Members: []string{"alice"}}, roomMsg{}, false},
+		{wire.Frame{Type: "unknown", Text: "from the future"}, roomMsg{}, false},
+	}
+
+	for _, tc := range testCases {
+		msg, shown := formatFrame(&tc.frame)
+		assert.Equal(t, tc.shown, shown, "%s frame", tc.frame.Type)
+		assert.Equal(t, tc.expected.text, msg.text, "%s frame", tc.frame.Type)
+		assert.Equal(t, tc.expected.replayed, msg.replayed, "%s frame", tc.frame.Type)
+		assert.True(t, tc.expected.sentAt.Equal(msg.sentAt), "%s frame: sent at %s", tc.frame.Type, msg.sentAt)
+	}
+}
@@ -1,9 +1,33 @@
 package chat
 
 import (
+	"strings"
+	"time"
+
 	"github.com/rivo/tview"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
 )
 
+// systemPrefix marks the room's replies meant for this client only, such as
+// the results of commands.
+const systemPrefix = "*** "
+
+// isCommand reports whether text is a room command rather than a message.
+// Messages starting with a slash are sent with the slash doubled.
+func isCommand(text string) bool {
+	return strings.HasPrefix(text, "/") && !strings.HasPrefix(text, "//")
+}
+
+// formatTime shows t in local time, with the date unless it is today.
+func formatTime(t time.Time) string {
+	t = t.Local()
+	if t.Format("20060102") == time.Now().Format("20060102") {
+		return t.Format("15:04")
+	}
+	return t.Format("Jan 2 15:04")
+}
+
 func center(width, height int, p tview.Primitive) tview.Primitive {
 	return tview.NewFlex().
 		AddItem(nil, 0, 1, false).
@@ -19,3 +43,31 @@ func newPrimitive() tview.Primitive {
 	return tview.NewFrame(nil).
 		SetBorders(0, 0, 0, 0, 0, 0)
 }
+
+// errorText renders err for the user. For gRPC errors it is the status message
+// followed by the field violations and quota failures it doesn't mention yet.
+func errorText(err error) string {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err.Error()
+	}
+	lines := []string{st.Message()}
+	addLine := func(subject, description string) {
+		if !strings.Contains(st.Message(), description) {
+			lines = append(lines, subject+": "+description)
+		}
+	}
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.BadRequest:
+			for _, v := range d.FieldViolations {
+				addLine(v.Field, v.Description)
+			}
+		case *errdetails.QuotaFailure:
+			for _, v := range d.Violations {
+				addLine(v.Subject, v.Description)
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
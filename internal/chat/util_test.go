@@ -0,0 +1,50 @@
+package chat
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/runtime/protoiface"
+)
+
+// withDetails returns the error of a status carrying details.
+func withDetails(t *testing.T, code codes.Code, msg string, details ...protoiface.MessageV1) error {
+	st, err := status.New(code, msg).WithDetails(details...)
+	require.NoError(t, err)
+	return st.Err()
+}
+
+func TestErrorText(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"plain error", errors.New("connection refused"), "connection refused"},
+		{"status", status.Error(codes.NotFound, `room "lobby" does not exist`), `room "lobby" does not exist`},
+		{"new violation", withDetails(t, codes.InvalidArgument, "invalid room name", &errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "name", Description: "must be 1 to 32 characters long"}},
+		}), "invalid room name\nname: must be 1 to 32 characters long"},
+		{"violation already in the message", withDetails(t, codes.InvalidArgument, "invalid size: room size must not be negative", &errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "size", Description: "room size must not be negative"}},
+		}), "invalid size: room size must not be negative"},
+		{"several violations", withDetails(t, codes.InvalidArgument, "invalid request", &errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{
+				{Field: "name", Description: "must not be empty"},
+				{Field: "password", Description: "too short"},
+			},
+		}), "invalid request\nname: must not be empty\npassword: too short"},
+		{"quota failure", withDetails(t, codes.ResourceExhausted, "slow down", &errdetails.QuotaFailure{
+			Violations: []*errdetails.QuotaFailure_Violation{{Subject: "client", Description: "too many messages"}},
+		}), "slow down\nclient: too many messages"},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, errorText(tc.err), tc.name)
+	}
+}
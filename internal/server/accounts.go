@@ -0,0 +1,371 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/dimaglushkov/go-chat/api/butlerpb"
+)
+
+const (
+	defaultTokenTTL = 24 * time.Hour
+	// minPasswordLength and maxPasswordLength bound account passwords in
+	// bytes, bcrypt ignores everything past 72 bytes.
+	minPasswordLength = 8
+	maxPasswordLength = 72
+	// guestMarker is appended to the names of the clients that join without
+	// logging in, on servers with accounts.
+	guestMarker = " (guest)"
+)
+
+// AccountConfig sets up the accounts clients can log in to, so that their
+// names can't be used by anybody else.
+type AccountConfig struct {
+	// File is the file accounts are kept in. Empty disables accounts.
+	File string
+	// TokenKey signs the session tokens. If empty a random key is used, so
+	// sessions end when the server restarts.
+	TokenKey []byte
+	// TokenTTL is how long session tokens are valid for. Zero means a day.
+	TokenTTL time.Duration
+	// NoGuests makes rooms only accept clients that have logged in. Guests
+	// are shown with a marker after their names otherwise.
+	NoGuests bool
+}
+
+// account is a record of the account file. Accounts are keyed by their names
+// in lower case, as names are unique regardless of case.
+type account struct {
+	Name         string    `json:"name"`
+	PasswordHash []byte    `json:"password_hash"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// session is the signed content of a session token.
+type session struct {
+	ID      string `json:"sid"`
+	Name    string `json:"name"`
+	Expires int64  `json:"exp"`
+}
+
+// accountStore keeps the accounts and ends the sessions that were logged out
+// of. The account file is loaded on first use, or up front by
+// Butler.LoadAccounts so that rooms checking names never wait on the disk. A
+// nil store is a server without accounts.
+type accountStore struct {
+	cfg AccountConfig
+	// saveMu serializes the writes of the account file, which are made
+	// without holding mu.
+	saveMu sync.Mutex
+
+	mu       sync.Mutex
+	loaded   bool
+	key      []byte
+	accounts map[string]account
+	// revoked holds the ids of the sessions that were logged out of until
+	// they expire.
+	revoked map[string]time.Time
+}
+
+// dummyHash is compared to the passwords of unknown names, so that they take
+// as long to reject as wrong passwords.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+
+func newAccountStore(cfg AccountConfig) *accountStore {
+	if cfg.File == "" {
+		return nil
+	}
+	if cfg.TokenTTL <= 0 {
+		cfg.TokenTTL = defaultTokenTTL
+	}
+	return &accountStore{cfg: cfg, revoked: make(map[string]time.Time)}
+}
+
+// load reads the account file unless it has been read already. mu must be
+// held.
+func (s *accountStore) load() error {
+	if s.loaded {
+		return nil
+	}
+	accounts := make(map[string]account)
+	data, err := os.ReadFile(s.cfg.File)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errInternal("error while reading accounts: %s", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &accounts); err != nil {
+			return errInternal("error while reading accounts: %s", err)
+		}
+	}
+	key := s.cfg.TokenKey
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return errInternal("error while generating token key: %s", err)
+		}
+	}
+	s.accounts, s.key, s.loaded = accounts, key, true
+	return nil
+}
+
+// save writes data to the account file, replacing it at once so that a crash
+// can't leave it half written. saveMu must be held.
+func (s *accountStore) save(data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(s.cfg.File), 0o700); err != nil {
+		return err
+	}
+	tmp := s.cfg.File + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.cfg.File)
+}
+
+func (s *accountStore) register(name, password string) error {
+	// hash before locking, rooms check names against the store
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return errInternal("error while hashing password: %s", err)
+	}
+	// the file is written without holding mu, saveMu keeps the snapshots
+	// of the accounts from being written out of order
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	s.mu.Lock()
+	if err := s.load(); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	key := strings.ToLower(name)
+	if _, ok := s.accounts[key]; ok {
+		s.mu.Unlock()
+		return errAccountExists(name)
+	}
+	s.accounts[key] = account{Name: name, PasswordHash: hash, CreatedAt: time.Now().UTC()}
+	data, err := json.MarshalIndent(s.accounts, "", "  ")
+	s.mu.Unlock()
+
+	if err == nil {
+		err = s.save(data)
+	}
+	if err != nil {
+		s.mu.Lock()
+		delete(s.accounts, key)
+		s.mu.Unlock()
+		return errInternal("error while saving accounts: %s", err)
+	}
+	return nil
+}
+
+// login checks the password of the account called name and returns the name
+// as it was registered.
+func (s *accountStore) login(name, password string) (string, error) {
+	s.mu.Lock()
+	if err := s.load(); err != nil {
+		s.mu.Unlock()
+		return "", err
+	}
+	acc, ok := s.accounts[strings.ToLower(name)]
+	hash := dummyHash
+	if ok {
+		hash = acc.PasswordHash
+	}
+	s.mu.Unlock()
+
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || !ok {
+		return "", errUnauthenticated("invalid name or password")
+	}
+	return acc.Name, nil
+}
+
+// registered reports whether somebody has an account called name. It is false
+// on a nil store. Rooms call it, so it must not wait on the account file being
+// written.
+func (s *accountStore) registered(name string) (bool, error) {
+	if s == nil {
+		return false, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return false, err
+	}
+	_, ok := s.accounts[strings.ToLower(name)]
+	return ok, nil
+}
+
+// issue returns a session token for the account called name and the time it
+// expires at.
+func (s *accountStore) issue(name string) (string, time.Time, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", time.Time{}, errInternal("error while generating session id: %s", err)
+	}
+	expires := time.Now().Add(s.cfg.TokenTTL).Truncate(time.Second)
+	payload, err := json.Marshal(session{ID: hex.EncodeToString(id), Name: name, Expires: expires.Unix()})
+	if err != nil {
+		return "", time.Time{}, errInternal("%s", err)
+	}
+	s.mu.Lock()
+	key := s.key
+	s.mu.Unlock()
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + sign(key, encoded), expires, nil
+}
+
+func sign(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify returns the session of token if it is signed by the server, hasn't
+// expired and hasn't been logged out of.
+func (s *accountStore) verify(token string) (session, error) {
+	var sess session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return sess, err
+	}
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(sign(s.key, payload))) {
+		return sess, errUnauthenticated("invalid session token")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || json.Unmarshal(data, &sess) != nil {
+		return sess, errUnauthenticated("invalid session token")
+	}
+	if time.Now().Unix() >= sess.Expires {
+		return sess, errUnauthenticated("session has expired, log in again")
+	}
+	if _, ok := s.revoked[sess.ID]; ok {
+		return sess, errUnauthenticated("session has been logged out of")
+	}
+	if _, ok := s.accounts[strings.ToLower(sess.Name)]; !ok {
+		return sess, errUnauthenticated("account no longer exists")
+	}
+	return sess, nil
+}
+
+// revoke ends sess before it expires.
+func (s *accountStore) revoke(sess session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, expires := range s.revoked {
+		if now.After(expires) {
+			delete(s.revoked, id)
+		}
+	}
+	s.revoked[sess.ID] = time.Unix(sess.Expires, 0)
+}
+
+// identity is who a member joins a room as.
+type identity struct {
+	name string
+	// loggedIn is set for the clients that joined with a session token,
+	// guest for the ones that didn't on a server with accounts.
+	loggedIn, guest bool
+}
+
+// identify tells who a member joining with token, or as name if it has none,
+// is.
+func (s *accountStore) identify(token, name string) (identity, error) {
+	if s == nil {
+		if token != "" {
+			return identity{}, errUnauthenticated("this server has no accounts")
+		}
+		return identity{name: name}, nil
+	}
+	if token != "" {
+		sess, err := s.verify(token)
+		if err != nil {
+			return identity{}, err
+		}
+		return identity{name: sess.Name, loggedIn: true}, nil
+	}
+	if s.cfg.NoGuests {
+		return identity{}, errUnauthenticated("log in to join rooms")
+	}
+	return identity{name: name, guest: true}, nil
+}
+
+// LoadAccounts reads the account file, if the server has accounts. Servers
+// should call it before serving anything, the file is read by whatever needs
+// it first otherwise, which may be a room.
+func (b *Butler) LoadAccounts() error {
+	if b.accounts == nil {
+		return nil
+	}
+	b.accounts.mu.Lock()
+	defer b.accounts.mu.Unlock()
+	if err := b.accounts.load(); err != nil {
+		return errors.New(status.Convert(err).Message())
+	}
+	return nil
+}
+
+func (b *Butler) Register(ctx context.Context, creds *butlerpb.Credentials) (*butlerpb.Session, error) {
+	if b.accounts == nil {
+		return nil, errAccountsDisabled()
+	}
+	if err := b.cfg.Room.Nicknames.validateNickname(creds.Name); err != nil {
+		return nil, err
+	}
+	if len(creds.Password) < minPasswordLength || len(creds.Password) > maxPasswordLength {
+		return nil, errInvalidArgument("password", fmt.Sprintf("password must be %d to %d bytes long", minPasswordLength, maxPasswordLength))
+	}
+	if err := b.accounts.register(creds.Name, creds.Password); err != nil {
+		return nil, err
+	}
+	return b.newSession(creds.Name)
+}
+
+func (b *Butler) Login(ctx context.Context, creds *butlerpb.Credentials) (*butlerpb.Session, error) {
+	if b.accounts == nil {
+		return nil, errAccountsDisabled()
+	}
+	name, err := b.accounts.login(creds.Name, creds.Password)
+	if err != nil {
+		return nil, err
+	}
+	return b.newSession(name)
+}
+
+func (b *Butler) newSession(name string) (*butlerpb.Session, error) {
+	token, expires, err := b.accounts.issue(name)
+	if err != nil {
+		return nil, err
+	}
+	return &butlerpb.Session{Token: token, Name: name, ExpiresAt: timestamppb.New(expires)}, nil
+}
+
+// Logout ends a session. Clients already in rooms stay in them.
+func (b *Butler) Logout(ctx context.Context, req *butlerpb.LogoutRequest) (*butlerpb.LogoutResponse, error) {
+	if b.accounts == nil {
+		return nil, errAccountsDisabled()
+	}
+	sess, err := b.accounts.verify(req.Token)
+	if err != nil {
+		return nil, err
+	}
+	b.accounts.revoke(sess)
+	return &butlerpb.LogoutResponse{}, nil
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/dimaglushkov/go-chat/api/butlerpb"
+	"github.com/dimaglushkov/go-chat/internal/wire"
+)
+
+func newAccountsButler(t *testing.T, cfg AccountConfig) *Butler {
+	if cfg.File == "" {
+		cfg.File = filepath.Join(t.TempDir(), "accounts.json")
+	}
+	butler := NewButler(Config{Accounts: cfg})
+	return &butler
+}
+
+func TestButler_RegisterLogin(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "data", "accounts.json")
+	butler := newAccountsButler(t, AccountConfig{File: file})
+
+	sess, err := butler.Register(ctx, &butlerpb.Credentials{Name: "Alice", Password: "correct horse"})
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", sess.Name)
+	assert.NotEmpty(t, sess.Token)
+	assert.WithinDuration(t, time.Now().Add(defaultTokenTTL), sess.ExpiresAt.AsTime(), time.Minute)
+
+	_, err = butler.Register(ctx, &butlerpb.Credentials{Name: "alice", Password: "another one"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	_, err = butler.Register(ctx, &butlerpb.Credentials{Name: "bob", Password: "short"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = butler.Register(ctx, &butlerpb.Credentials{Name: "bad name", Password: "long enough"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = butler.Login(ctx, &butlerpb.Credentials{Name: "alice", Password: "wrong horse"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = butler.Login(ctx, &butlerpb.Credentials{Name: "nobody", Password: "correct horse"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// accounts are kept on disk, with the passwords hashed
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "correct horse")
+
+	restarted := newAccountsButler(t, AccountConfig{File: file})
+	sess, err = restarted.Login(ctx, &butlerpb.Credentials{Name: "alice", Password: "correct horse"})
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", sess.Name, "the name is the one registered")
+
+	plain := NewButler(Config{})
+	_, err = plain.Login(ctx, &butlerpb.Credentials{Name: "alice", Password: "correct horse"})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestButler_LoadAccounts(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "accounts.json")
+	butler := newAccountsButler(t, AccountConfig{File: file})
+	_, err := butler.Register(ctx, &butlerpb.Credentials{Name: "alice", Password: "correct horse"})
+	require.NoError(t, err)
+
+	restarted := newAccountsButler(t, AccountConfig{File: file})
+	require.NoError(t, restarted.LoadAccounts())
+	require.NoError(t, os.Remove(file))
+	registered, err := restarted.accounts.registered("Alice")
+	require.NoError(t, err)
+	assert.True(t, registered, "accounts are kept in memory once loaded")
+
+	require.NoError(t, os.WriteFile(file, []byte("not json"), 0o600))
+	assert.ErrorContains(t, newAccountsButler(t, AccountConfig{File: file}).LoadAccounts(), "error while reading accounts")
+	plain := NewButler(Config{})
+	assert.NoError(t, plain.LoadAccounts())
+}
+
+func TestAccountStore_Tokens(t *testing.T) {
+	ctx := context.Background()
+	butler := newAccountsButler(t, AccountConfig{TokenKey: []byte("secret")})
+	sess, err := butler.Register(ctx, &butlerpb.Credentials{Name: "alice", Password: "correct horse"})
+	require.NoError(t, err)
+	store := butler.accounts
+
+	got, err := store.verify(sess.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", got.Name)
+
+	for _, token := range []string{"", "garbage", sess.Token + "x", "e30." + sess.Token[len(sess.Token)-43:]} {
+		_, err := store.verify(token)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err), "token %q", token)
+	}
+
+	// tokens signed with another key are rejected
+	other := newAccountsButler(t, AccountConfig{File: store.cfg.File, TokenKey: []byte("other secret")})
+	_, err = other.accounts.verify(sess.Token)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	store.cfg.TokenTTL = -time.Second
+	expired, _, err := store.issue("alice")
+	require.NoError(t, err)
+	_, err = store.verify(expired)
+	require.Error(t, err)
+	assert.Contains(t, status.Convert(err).Message(), "expired")
+
+	_, err = butler.Logout(ctx, &butlerpb.LogoutRequest{Token: sess.Token})
+	require.NoError(t, err)
+	_, err = store.verify(sess.Token)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = butler.Logout(ctx, &butlerpb.LogoutRequest{Token: sess.Token})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestRoom_Accounts(t *testing.T) {
+	ctx := context.Background()
+	butler := newAccountsButler(t, AccountConfig{})
+	addr := serveRooms(t, butler)
+	chat := butlerpb.NewChatClient(startButler(t, butler))
+	alice, err := butler.Register(ctx, &butlerpb.Credentials{Name: "alice", Password: "correct horse"})
+	require.NoError(t, err)
+	carol, err := butler.Register(ctx, &butlerpb.Credentials{Name: "carol", Password: "battery staple"})
+	require.NoError(t, err)
+	ref, err := butler.CreateRoom(ctx, &butlerpb.RoomNameSize{Name: "accounts", Size: 5})
+	require.NoError(t, err)
+
+	// the name comes from the token, not from the hello
+	a := dialRoom(t, addr, wire.Frame{Room: ref.Id, Name: "mallory", Token: alice.Token})
+	assert.Equal(t, wire.TypeHello, a.next(t).Type)
+	assert.Equal(t, wire.TypePresence, a.next(t).Type)
+	a.expect(t, "alice joined")
+
+	// guests can't use registered names and are marked
+	impostor := dialRoom(t, addr, wire.Frame{Room: ref.Id, Name: "Alice"})
+	assert.Equal(t, wire.TypeHello, impostor.next(t).Type)
+	impostor.expect(t, `*** rejected: user name "Alice" is registered, log in to use it`)
+	bob := dialRoom(t, addr, wire.Frame{Room: ref.Id, Name: "bob"})
+	assert.Equal(t, wire.TypeHello, bob.next(t).Type)
+	assert.Equal(t, []string{"alice", "bob (guest)"}, bob.next(t).Members)
+	bob.expect(t, "bob (guest) joined")
+	a.expect(t, "bob (guest) joined")
+	bob.say(t, "/nick carol")
+	bob.expect(t, `*** can't change name: user name "carol" is registered, log in to use it`)
+	bob.say(t, "/nick bobby")
+	a.expect(t, "presence frame")
+	a.expect(t, "bob (guest) is now known as bobby (guest)")
+
+	// accounts keep their names
+	a.say(t, "/nick al")
+	a.expect(t, "*** can't change name: logged in users keep the name of their account")
+
+	// plain-text clients send their token instead of a name
+	lines := dialRoomLines(t, addr, ref.Id, tokenPrefix+carol.Token)
+	lines.expect(t, "carol joined")
+	a.expect(t, "carol joined")
+	dialRoomLines(t, addr, ref.Id, tokenPrefix+"forged").expect(t, "*** rejected: invalid session token")
+
+	// and so do gRPC ones
+	_, err = butler.Logout(ctx, &butlerpb.LogoutRequest{Token: alice.Token})
+	require.NoError(t, err)
+	stream := joinStream(t, chat, &butlerpb.ChatJoin{RoomId: ref.Id, Token: alice.Token})
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	relogged, err := butler.Login(ctx, &butlerpb.Credentials{Name: "carol", Password: "battery staple"})
+	require.NoError(t, err)
+	stream = joinStream(t, chat, &butlerpb.ChatJoin{RoomId: ref.Id, Token: relogged.Token})
+	_, err = stream.Recv()
+	assert.Equal(t, codes.AlreadyExists, status.Code(err), "carol is already in the room")
+}
+
+func TestRoom_NoGuests(t *testing.T) {
+	ctx := context.Background()
+	butler := newAccountsButler(t, AccountConfig{NoGuests: true})
+	addr := serveRooms(t, butler)
+	alice, err := butler.Register(ctx, &butlerpb.Credentials{Name: "alice", Password: "correct horse"})
+	require.NoError(t, err)
+	ref, err := butler.CreateRoom(ctx, &butlerpb.RoomNameSize{Name: "members only", Size: 5})
+	require.NoError(t, err)
+
+	dialRoomLines(t, addr, ref.Id, "guest").expect(t, "*** rejected: log in to join rooms")
+	dialRoomLines(t, addr, ref.Id, tokenPrefix+alice.Token).expect(t, "alice joined")
+}
+
+func TestRoom_TokenWithoutAccounts(t *testing.T) {
+	butler := NewButler(Config{})
+	addr := serveRooms(t, &butler)
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "open", Size: 5})
+	require.NoError(t, err)
+
+	// without accounts names are used as they are
+	dialRoomLines(t, addr, ref.Id, "guest").expect(t, "guest joined")
+	dialRoomLines(t, addr, ref.Id, tokenPrefix+"token").expect(t, "*** rejected: this server has no accounts")
+}
@@ -1,29 +1,85 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/peer"
 
 	"github.com/dimaglushkov/go-chat/api/butlerpb"
+	"github.com/dimaglushkov/go-chat/internal/wire"
 )
 
-const maxRoomSize = 99
+const (
+	maxRoomSize = 99
+	maxRooms    = 1000
+
+	defaultListPageSize = 20
+	maxListPageSize     = 100
+)
+
+// handshakeTimeout limits how long a new room connection may take to name
+// the room it wants to join and who it is. It is a variable for the tests.
+var handshakeTimeout = 10 * time.Second
 
 type Butler struct {
 	butlerpb.ButlerServer
-	mu    sync.RWMutex
-	rooms map[string]int32
+	butlerpb.UnimplementedChatServer
+	mu        sync.RWMutex
+	rooms     map[string]*room
+	roomsByID map[string]*room
+	reserved  map[string]bool
+	watchers  map[*roomWatcher]bool
+	commands  commandSet
+	roomAddr  net.Addr
+	// roomTLSAddr is the address of the room listener secured with TLS,
+	// if any.
+	roomTLSAddr net.Addr
+	// accounts is nil unless cfg.Accounts.File is set.
+	accounts *accountStore
+	tickets  *ticketStore
+	// ips holds the rate limiting state of client addresses for every room.
+	ips *ipStore
+	// metrics is nil unless cfg.Metrics is set.
+	metrics *metrics
+	// closing is set and done closed once Shutdown is called.
+	closing bool
+	done    chan struct{}
+	cfg     Config
 }
 
-func NewButler() (butler Butler) {
-	butler.rooms = make(map[string]int32)
+func NewButler(cfg Config) (butler Butler) {
+	butler.cfg = cfg
+	butler.rooms = make(map[string]*room)
+	butler.roomsByID = make(map[string]*room)
+	butler.reserved = make(map[string]bool)
+	butler.watchers = make(map[*roomWatcher]bool)
+	butler.commands = builtinCommands
+	butler.accounts = newAccountStore(cfg.Accounts)
+	butler.tickets = newTicketStore()
+	butler.ips = newIPStore()
+	butler.metrics = newMetrics(cfg.Metrics)
+	butler.done = make(chan struct{})
 	return
 }
 
-func (b *Butler) CreateRoom(ctx context.Context, roomNameSize *butlerpb.RoomNameSize) (*butlerpb.RoomPort, error) {
+func (b *Butler) CreateRoom(ctx context.Context, roomNameSize *butlerpb.RoomNameSize) (*butlerpb.RoomRef, error) {
+	if err := b.cfg.RoomNames.validateRoomName(roomNameSize.Name); err != nil {
+		return nil, err
+	}
+	if roomNameSize.Size < 0 {
+		return nil, errInvalidArgument("size", "room size must not be negative")
+	}
 	var roomSize int
 	if roomNameSize.Size <= 0 || roomNameSize.Size > maxRoomSize {
 		roomSize = maxRoomSize
@@ -31,40 +87,295 @@ func (b *Butler) CreateRoom(ctx context.Context, roomNameSize *butlerpb.RoomName
 		roomSize = int(roomNameSize.Size)
 	}
 
+	limits, err := rateLimitsFromProto(roomNameSize.Limits)
+	if err != nil {
+		return nil, err
+	}
+	cfg := b.cfg.Room
+	cfg.Limits = cfg.Limits.stricter(limits)
+
+	if err := b.reserveRoom(roomNameSize.Name); err != nil {
+		return nil, err
+	}
+	cr, err := NewRoom(roomNameSize.Name, roomSize, cfg)
+	if err != nil {
+		b.releaseRoom(roomNameSize.Name)
+		return nil, errInternal("%s", err)
+	}
+	if err = cr.setPassword(roomNameSize.Password); err != nil {
+		b.releaseRoom(roomNameSize.Name)
+		return nil, errInternal("error while setting room password: %s", err)
+	}
+	user := userOf(ctx, roomNameSize.Creator)
+	cr.creator = user
+	if cr.creator == "" {
+		if p, ok := peer.FromContext(ctx); ok {
+			cr.creator = p.Addr.String()
+		}
+	}
+	ticket, err := b.issueTicket(cr, user)
+	if err != nil {
+		b.releaseRoom(roomNameSize.Name)
+		return nil, err
+	}
+	// the log is opened last, so that it only needs closing if the room
+	// can't be committed
+	if b.cfg.Room.Log.Dir != "" {
+		if cr.chatLog, err = openRoomLog(b.cfg.Room.Log, cr.id); err != nil {
+			b.tickets.revoke(ticket)
+			b.releaseRoom(roomNameSize.Name)
+			return nil, errInternal("%s", err)
+		}
+	}
 	b.mu.RLock()
-	_, ok := b.rooms[roomNameSize.Name]
+	cr.commands = b.commands
 	b.mu.RUnlock()
-	if ok {
-		return nil, fmt.Errorf("room \"%s\" already exists", roomNameSize.Name)
+	cr.accounts = b.accounts
+	cr.tickets = b.tickets
+	cr.ips = b.ips
+	cr.metrics = b.metrics
+	cr.onChange = func() {
+		b.mu.RLock()
+		b.publish(butlerpb.RoomEvent_OCCUPANCY_CHANGED, cr)
+		b.mu.RUnlock()
 	}
-	cr, err := NewRoom(roomSize)
-	if err != nil {
-		return &butlerpb.RoomPort{Port: 0, Exists: false}, err
+	if err := b.commitRoom(cr); err != nil {
+		b.tickets.revoke(ticket)
+		cr.chatLog.close()
+		return nil, err
 	}
-	roomPort := int32(cr.GetPort())
 
 	go func() {
-		log.Printf("creating room \"%s\" at port %d\n", roomNameSize.Name, roomPort)
-		b.mu.Lock()
-		b.rooms[roomNameSize.Name] = roomPort
-		b.mu.Unlock()
+		reason := cr.Open()
+		b.removeRoom(cr)
+		log.Printf("room \"%s\" with id %s closed successfully (%s)", cr.name, cr.id, reason)
+	}()
+	return &butlerpb.RoomRef{Id: cr.id, Private: cr.isPrivate(), Ticket: ticket}, nil
+}
+
+func (b *Butler) FindRoom(ctx context.Context, roomName *butlerpb.RoomName) (*butlerpb.RoomRef, error) {
+	if b.isClosing() {
+		return nil, errShuttingDown()
+	}
+	cr, ok := b.findRoom(roomName.Name)
+	if !ok {
+		return nil, errRoomNotFound(roomName.Name)
+	}
+	if !cr.checkPassword(roomName.Password) {
+		return nil, errInvalidPassword(roomName.Name)
+	}
+	ticket, err := b.issueTicket(cr, userOf(ctx, roomName.User))
+	if err != nil {
+		return nil, err
+	}
+	return &butlerpb.RoomRef{Id: cr.id, Private: cr.isPrivate(), Ticket: ticket}, nil
+}
 
-		cr.Open()
+// userOf returns the user name a request was sent for: the name in the
+// client certificate of the peer of ctx if it has one, user otherwise.
+func userOf(ctx context.Context, user string) string {
+	if cert := clientCert(peerTLSState(ctx)); cert != nil {
+		return certName(cert)
+	}
+	return user
+}
 
-		b.mu.Lock()
-		delete(b.rooms, roomNameSize.Name)
-		b.mu.Unlock()
-		log.Printf("room \"%s\" at port %d closed successfully", roomNameSize.Name, roomPort)
-	}()
-	return &butlerpb.RoomPort{Port: roomPort, Exists: true}, nil
+// issueTicket returns a join ticket to cr for user, none if the request
+// didn't name a user.
+func (b *Butler) issueTicket(cr *room, user string) (string, error) {
+	if user == "" {
+		return "", nil
+	}
+	ticket, err := b.tickets.issue(cr.id, user)
+	if err != nil {
+		return "", errInternal("%s", err)
+	}
+	return ticket, nil
 }
 
-func (b *Butler) FindRoom(ctx context.Context, roomName *butlerpb.RoomName) (*butlerpb.RoomPort, error) {
+// ListRooms returns open rooms ordered by name. The page token is the name of
+// the last room of the previous page, so rooms created or closed between the
+// calls neither shift nor repeat the following pages.
+func (b *Butler) ListRooms(ctx context.Context, req *butlerpb.ListRoomsRequest) (*butlerpb.ListRoomsResponse, error) {
+	if req.PageSize < 0 {
+		return nil, errInvalidArgument("page_size", "page size must not be negative")
+	}
+	pageSize := int(req.PageSize)
+	if pageSize == 0 {
+		pageSize = defaultListPageSize
+	} else if pageSize > maxListPageSize {
+		pageSize = maxListPageSize
+	}
+
 	b.mu.RLock()
-	roomPort, ok := b.rooms[roomName.Name]
+	names := make([]string, 0, len(b.rooms))
+	for name := range b.rooms {
+		if strings.HasPrefix(name, req.NamePrefix) && (req.PageToken == "" || name > req.PageToken) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	resp := &butlerpb.ListRoomsResponse{}
+	for _, name := range names {
+		if len(resp.Rooms) == pageSize {
+			resp.NextPageToken = resp.Rooms[pageSize-1].Name
+			break
+		}
+		resp.Rooms = append(resp.Rooms, b.rooms[name].info())
+	}
 	b.mu.RUnlock()
+
+	return resp, nil
+}
+
+func (b *Butler) GetServerInfo(ctx context.Context, req *butlerpb.ServerInfoRequest) (*butlerpb.ServerInfo, error) {
+	info := &butlerpb.ServerInfo{}
+	b.mu.RLock()
+	if addr, ok := b.roomAddr.(*net.TCPAddr); ok {
+		info.RoomPort = int32(addr.Port)
+	}
+	if addr, ok := b.roomTLSAddr.(*net.TCPAddr); ok {
+		info.RoomTlsPort = int32(addr.Port)
+	}
+	b.mu.RUnlock()
+	return info, nil
+}
+
+// ServeRooms accepts connections for every room on a single listener. Each
+// connection starts with a hello frame naming the room to join or, for
+// clients of the plain-text protocol, with a line holding the room id. The
+// rest of the conversation is handled by the room itself.
+func (b *Butler) ServeRooms(listener net.Listener) error {
+	b.mu.Lock()
+	b.roomAddr = listener.Addr()
+	b.mu.Unlock()
+	return b.acceptRooms(listener)
+}
+
+// ServeRoomsTLS is ServeRooms for connections secured with TLS. It can be run
+// next to ServeRooms, clients learn the ports of both from GetServerInfo.
+func (b *Butler) ServeRoomsTLS(listener net.Listener, config *tls.Config) error {
+	b.mu.Lock()
+	b.roomTLSAddr = listener.Addr()
+	b.mu.Unlock()
+	return b.acceptRooms(tls.NewListener(listener, config))
+}
+
+func (b *Butler) acceptRooms(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			log.Printf("error while accepting room connection: %s", err)
+			continue
+		}
+		go b.routeConn(conn)
+	}
+}
+
+func (b *Butler) routeConn(conn net.Conn) {
+	if b.isClosing() {
+		b.rejectConn(conn, errShuttingDown())
+		return
+	}
+	rd := bufio.NewReader(conn)
+	// the deadline is cleared by the room once the client is through the
+	// handshake
+	conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	line, err := wire.ReadLine(rd, wire.MaxFrameSize)
+	if err != nil {
+		log.Printf("connection from %s dropped before naming a room: %s", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+
+	// frames are JSON objects, anything else is the room id sent by a
+	// client of the plain-text protocol
+	if !bytes.HasPrefix(line, []byte("{")) {
+		id, ticket := roomOfTicket(strings.TrimSpace(string(line)))
+		cr, ok := b.findRoomByID(id)
+		if !ok {
+			log.Printf("rejected connection from %s: %s", conn.RemoteAddr(), errRoomNotFound(id))
+			b.metrics.rejectedConn(errRoomNotFound(id))
+			msg, _ := rejection(errRoomNotFound(id)).line()
+			fmt.Fprintln(conn, msg)
+			conn.Close()
+			return
+		}
+		cr.handleLineConn(conn, rd, ticket)
+		return
+	}
+
+	hello, err := wire.Parse(line)
+	if err == nil && hello.Type != wire.TypeHello {
+		err = fmt.Errorf("expected a hello frame, got %s", hello.Type)
+	}
+	if err != nil {
+		b.rejectConn(conn, errInvalidArgument("frame", err.Error()))
+		return
+	}
+	if hello.Version != wire.Version {
+		b.rejectConn(conn, errUnsupportedVersion(hello.Version))
+		return
+	}
+	// the hello only settles the version, the room still has to admit the
+	// client, which it confirms with a presence frame
+	wire.Write(conn, &wire.Frame{Type: wire.TypeHello, Version: wire.Version})
+
+	if hello.Room == "" {
+		hello.Room, _ = roomOfTicket(hello.Ticket)
+	}
+	cr, ok := b.findRoomByID(hello.Room)
 	if !ok {
-		return nil, fmt.Errorf("room %s does not exist", roomName.Name)
+		b.rejectConn(conn, errRoomNotFound(hello.Room))
+		return
+	}
+	cr.handleConn(conn, rd, hello)
+}
+
+// Shutdown stops the Butler from taking new rooms and members and sends
+// notice to every room. The rooms then close as soon as their clients have
+// been sent everything queued for them. Shutdown waits for that until ctx is
+// done and returns its error if it comes first. Room listeners are left for
+// the caller to close.
+func (b *Butler) Shutdown(ctx context.Context, notice string) error {
+	b.mu.Lock()
+	if !b.closing {
+		b.closing = true
+		close(b.done)
 	}
-	return &butlerpb.RoomPort{Port: roomPort, Exists: true}, nil
+	rooms := make([]*room, 0, len(b.rooms))
+	for _, r := range b.rooms {
+		rooms = append(rooms, r)
+	}
+	b.mu.Unlock()
+
+	log.Printf("shutting down %d rooms", len(rooms))
+	for _, r := range rooms {
+		r.drain(notice)
+	}
+	for _, r := range rooms {
+		select {
+		case <-r.drained():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (b *Butler) isClosing() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.closing
+}
+
+func (b *Butler) rejectConn(conn net.Conn, err error) {
+	log.Printf("rejected connection from %s: %s", conn.RemoteAddr(), err)
+	b.metrics.rejectedConn(err)
+	wire.Write(conn, rejection(err).frame())
+	conn.Close()
 }
@@ -1,18 +1,34 @@
 package server
 
 import (
-	"bufio"
 	"context"
+	"io"
+	"net"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/dimaglushkov/go-chat/api/butlerpb"
+	"github.com/dimaglushkov/go-chat/internal/wire"
 )
 
+func serveRooms(t testing.TB, butler *Butler) string {
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	go butler.ServeRooms(listener)
+	t.Cleanup(func() { listener.Close() })
+	return listener.Addr().String()
+}
+
 func TestButler_CreateRoomValid(t *testing.T) {
-	butler := NewButler()
+	butler := NewButler(Config{})
+	addr := serveRooms(t, &butler)
 	ctx := context.Background()
 	rns := &butlerpb.RoomNameSize{
 		Size: 1200,
@@ -22,50 +38,257 @@ func TestButler_CreateRoomValid(t *testing.T) {
 	rp, err := butler.CreateRoom(ctx, rns)
 	assert.NoError(t, err)
 
-	conn, err := connectToRoom(rp)
+	c := joinTestClient(t, addr, rp, "testName")
+	c.say(t, "test message")
+}
+
+func TestButler_FindRoom(t *testing.T) {
+	butler := NewButler(Config{})
+	addr := serveRooms(t, &butler)
+	ctx := context.Background()
+	rns := &butlerpb.RoomNameSize{
+		Size: 20,
+		Name: "testRoom",
+	}
+
+	rp, err := butler.CreateRoom(ctx, rns)
 	require.NoError(t, err)
-	defer conn.Close()
 
-	w := bufio.NewWriter(conn)
-	err = sendMsg(w, "testName")
+	c := joinTestClient(t, addr, rp, "testName")
+
+	r1, err := butler.FindRoom(ctx, &butlerpb.RoomName{Name: rns.Name})
+	require.NoError(t, err)
+	require.Equal(t, rp.Id, r1.Id)
+
+	r2, err := butler.FindRoom(ctx, &butlerpb.RoomName{Name: "_testName_"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	require.Nil(t, r2)
+
+	// the room closes once its last client leaves
+	c.conn.Close()
+	require.Eventually(t, func() bool {
+		_, err := butler.FindRoom(ctx, &butlerpb.RoomName{Name: rns.Name})
+		return status.Code(err) == codes.NotFound
+	}, 3*time.Second, 10*time.Millisecond)
+}
+
+func TestButler_ListRooms(t *testing.T) {
+	butler := NewButler(Config{})
+	ctx := context.Background()
+	for _, name := range []string{"team-b", "team-a", "other", "team-c"} {
+		_, err := butler.CreateRoom(ctx, &butlerpb.RoomNameSize{Name: name, Size: 5, Creator: "tester"})
+		require.NoError(t, err)
+	}
+	require.Eventually(t, func() bool {
+		resp, err := butler.ListRooms(ctx, &butlerpb.ListRoomsRequest{})
+		return err == nil && len(resp.Rooms) == 4
+	}, 3*time.Second, 50*time.Millisecond)
+
+	resp, err := butler.ListRooms(ctx, &butlerpb.ListRoomsRequest{NamePrefix: "team-", PageSize: 2})
 	require.NoError(t, err)
+	require.Len(t, resp.Rooms, 2)
+	assert.Equal(t, "team-a", resp.Rooms[0].Name)
+	assert.Equal(t, "team-b", resp.Rooms[1].Name)
+	assert.Equal(t, int32(5), resp.Rooms[0].Size)
+	assert.Equal(t, int32(0), resp.Rooms[0].Members)
+	assert.Equal(t, "tester", resp.Rooms[0].Creator)
+	assert.NotNil(t, resp.Rooms[0].CreatedAt)
+	require.NotEmpty(t, resp.NextPageToken)
 
-	err = sendMsg(w, "test message")
+	resp, err = butler.ListRooms(ctx, &butlerpb.ListRoomsRequest{NamePrefix: "team-", PageSize: 2, PageToken: resp.NextPageToken})
 	require.NoError(t, err)
+	require.Len(t, resp.Rooms, 1)
+	assert.Equal(t, "team-c", resp.Rooms[0].Name)
+	assert.Empty(t, resp.NextPageToken)
 }
 
-/*func TestButler_FindRoom(t *testing.T) {
-	butler := NewButler()
+func TestButler_PrivateRoom(t *testing.T) {
+	butler := NewButler(Config{})
+	addr := serveRooms(t, &butler)
 	ctx := context.Background()
 	rns := &butlerpb.RoomNameSize{
-		Size: 20,
-		Name: "testRoom",
+		Size:     5,
+		Name:     "privateRoom",
+		Password: "s3cret",
 	}
 
 	rp, err := butler.CreateRoom(ctx, rns)
 	require.NoError(t, err)
+	assert.True(t, rp.Private)
+	require.Eventually(t, func() bool {
+		_, err := butler.FindRoom(ctx, &butlerpb.RoomName{Name: rns.Name, Password: rns.Password})
+		return err == nil
+	}, 3*time.Second, 50*time.Millisecond)
+
+	_, err = butler.FindRoom(ctx, &butlerpb.RoomName{Name: rns.Name})
+	assert.Error(t, err)
+	_, err = butler.FindRoom(ctx, &butlerpb.RoomName{Name: rns.Name, Password: "wrong"})
+	assert.Error(t, err)
+
+	list, err := butler.ListRooms(ctx, &butlerpb.ListRoomsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Rooms, 1)
+	assert.True(t, list.Rooms[0].Private)
+
+	intruder := dialRoom(t, addr, wire.Frame{Room: rp.Id, Name: "intruder", Password: "guess"})
+	assert.Equal(t, wire.TypeHello, intruder.next(t).Type)
+	reply := intruder.next(t)
+	assert.Equal(t, wire.TypeError, reply.Type)
+	assert.Equal(t, codes.PermissionDenied.String(), reply.Code)
+	assert.Equal(t, "invalid password for room \"privateRoom\"", reply.Text)
+	intruder.expectClosed(t)
+
+	member := dialRoom(t, addr, wire.Frame{Room: rp.Id, Name: "member", Password: rns.Password})
+	assert.Equal(t, wire.TypeHello, member.next(t).Type)
+	assert.Equal(t, []string{"member"}, member.next(t).Members)
+	member.expect(t, "member joined")
+}
+
+func TestButler_ServeRooms(t *testing.T) {
+	butler := NewButler(Config{})
+	addr := serveRooms(t, &butler)
+	ctx := context.Background()
+
+	require.Eventually(t, func() bool {
+		info, err := butler.GetServerInfo(ctx, &butlerpb.ServerInfoRequest{})
+		return err == nil && addr == "127.0.0.1:"+strconv.Itoa(int(info.RoomPort))
+	}, time.Second, 10*time.Millisecond)
+
+	c := dialRoom(t, addr, wire.Frame{Room: "missing", Name: "user"})
+	assert.Equal(t, wire.TypeHello, c.next(t).Type)
+	c.expect(t, "*** rejected: room \"missing\" does not exist")
+	c.expectClosed(t)
+
+	c = dialRoom(t, addr, wire.Frame{Version: wire.Version + 1, Room: "missing", Name: "user"})
+	reply := c.next(t)
+	assert.Equal(t, wire.TypeError, reply.Type)
+	assert.Equal(t, codes.Unimplemented.String(), reply.Code)
+	c.expectClosed(t)
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	c = &testClient{conn: conn, r: wire.NewReader(conn)}
+	c.send(t, wire.Frame{Type: wire.TypeChat, Text: "no hello"})
+	reply = c.next(t)
+	assert.Equal(t, wire.TypeError, reply.Type)
+	assert.Equal(t, codes.InvalidArgument.String(), reply.Code)
+	c.expectClosed(t)
+}
+
+func TestButler_StatusCodes(t *testing.T) {
+	butler := NewButler(Config{})
+	ctx := context.Background()
+
+	_, err := butler.CreateRoom(ctx, &butlerpb.RoomNameSize{Name: ""})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	details := status.Convert(err).Details()
+	require.Len(t, details, 1)
+	badRequest, ok := details[0].(*errdetails.BadRequest)
+	require.True(t, ok)
+	assert.Equal(t, "name", badRequest.FieldViolations[0].Field)
+
+	_, err = butler.CreateRoom(ctx, &butlerpb.RoomNameSize{Name: "codes", Password: "pass"})
+	require.NoError(t, err)
+	_, err = butler.CreateRoom(ctx, &butlerpb.RoomNameSize{Name: "codes"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	_, err = butler.FindRoom(ctx, &butlerpb.RoomName{Name: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = butler.FindRoom(ctx, &butlerpb.RoomName{Name: "codes", Password: "wrong"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = butler.ListRooms(ctx, &butlerpb.ListRoomsRequest{PageSize: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	for i := len(butler.rooms); i < maxRooms; i++ {
+		_, err = butler.CreateRoom(ctx, &butlerpb.RoomNameSize{Name: "filler" + strconv.Itoa(i)})
+		require.NoError(t, err)
+	}
+	_, err = butler.CreateRoom(ctx, &butlerpb.RoomNameSize{Name: "one too many"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestButler_UnjoinedRoomExpires(t *testing.T) {
+	butler := NewButler(Config{Room: RoomConfig{JoinTimeout: 100 * time.Millisecond}})
+	ctx := context.Background()
 
-	conn, err := connectToRoom(rp)
+	_, err := butler.CreateRoom(ctx, &butlerpb.RoomNameSize{Name: "forgotten"})
 	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, err := butler.FindRoom(ctx, &butlerpb.RoomName{Name: "forgotten"})
+		return status.Code(err) == codes.NotFound
+	}, 3*time.Second, 50*time.Millisecond)
+}
 
-	w := bufio.NewWriter(conn)
-	_, err = w.Write([]byte("testName\n"))
+func TestButler_Shutdown(t *testing.T) {
+	ctx := context.Background()
+	butler := NewButler(Config{Room: RoomConfig{IdleTimeout: time.Hour}})
+	addr := serveRooms(t, &butler)
+	client := butlerpb.NewButlerClient(startButler(t, &butler))
+	chat := butlerpb.NewChatClient(startButler(t, &butler))
+
+	ref, err := butler.CreateRoom(ctx, &butlerpb.RoomNameSize{Name: "busy", Size: 5})
+	require.NoError(t, err)
+	_, err = butler.CreateRoom(ctx, &butlerpb.RoomNameSize{Name: "empty", Size: 5})
+	require.NoError(t, err)
+	alice := joinTestClient(t, addr, ref, "alice")
+	lines := dialRoomLines(t, addr, ref.Id, "bob")
+	lines.expect(t, "bob joined")
+	alice.expect(t, "bob joined")
+	stream := joinStream(t, chat, &butlerpb.ChatJoin{RoomId: ref.Id, Name: "carol"})
+	msg, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "carol joined", msg.Text)
+	alice.expect(t, "carol joined")
+	lines.expect(t, "carol joined")
+	watch, err := client.WatchRooms(ctx, &butlerpb.WatchRoomsRequest{})
 	require.NoError(t, err)
-	err = w.Flush()
+	_, err = watch.Recv()
 	require.NoError(t, err)
 
-	r1, err := butler.FindRoom(ctx, &butlerpb.RoomName{Name: rns.Name})
+	require.NoError(t, butler.Shutdown(ctx, "server going down for maintenance"))
+
+	// every client gets the notice, then the room closes its connection
+	alice.expect(t, "server going down for maintenance")
+	alice.expectClosed(t)
+	lines.expect(t, "server going down for maintenance")
+	_, err = lines.r.ReadString('\n')
+	assert.Error(t, err)
+	msg, err = stream.Recv()
 	require.NoError(t, err)
-	require.NotNil(t, r1)
+	assert.Equal(t, "server going down for maintenance", msg.Text)
+	_, err = stream.Recv()
+	assert.ErrorIs(t, err, io.EOF)
+	for {
+		_, err = watch.Recv()
+		if err != nil {
+			break
+		}
+	}
+	assert.Equal(t, codes.Unavailable, status.Code(err))
 
-	r2, err := butler.FindRoom(ctx, &butlerpb.RoomName{Name: "_testName_"})
-	require.Error(t, err)
-	require.Nil(t, r2)
+	// and nothing new is let in
+	_, err = butler.CreateRoom(ctx, &butlerpb.RoomNameSize{Name: "late", Size: 5})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	_, err = butler.FindRoom(ctx, &butlerpb.RoomName{Name: "busy"})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	late := dialRoom(t, addr, wire.Frame{Room: ref.Id, Name: "dave"})
+	late.expect(t, "*** rejected: server is shutting down")
+	_, ok := butler.findRoom("busy")
+	assert.False(t, ok)
+	_, ok = butler.findRoom("empty")
+	assert.False(t, ok)
+}
 
-	conn.Close()
-	time.Sleep(3 * time.Second)
-	r1, err = butler.FindRoom(ctx, &butlerpb.RoomName{Name: rns.Name})
-	require.Error(t, err)
-	require.Nil(t, r1)
+func TestButler_ShutdownDeadline(t *testing.T) {
+	butler := NewButler(Config{})
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "stuck", Size: 5})
+	require.NoError(t, err)
+	joinStalledClient(t, &butler, ref, "slow")
 
-}*/
+	// the notice can't be written to a client that doesn't read
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, butler.Shutdown(ctx, "bye"), context.DeadlineExceeded)
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"crypto/tls"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/dimaglushkov/go-chat/api/butlerpb"
+)
+
+// streamMember is a room member connected through the Chat.Join stream.
+// Incoming messages are pumped through a channel, so recv can be interrupted
+// without ending the stream.
+type streamMember struct {
+	stream   butlerpb.Chat_JoinServer
+	addr     string
+	incoming chan *butlerpb.ChatClientMessage
+	recvErr  chan error
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+func newStreamMember(stream butlerpb.Chat_JoinServer, addr string) *streamMember {
+	m := &streamMember{
+		stream:   stream,
+		addr:     addr,
+		incoming: make(chan *butlerpb.ChatClientMessage),
+		recvErr:  make(chan error, 1),
+		stopped:  make(chan struct{}),
+	}
+	go m.pump()
+	return m
+}
+
+func (m *streamMember) pump() {
+	for {
+		msg, err := m.stream.Recv()
+		if err != nil {
+			m.recvErr <- err
+			return
+		}
+		select {
+		case m.incoming <- msg:
+		case <-m.stopped:
+			return
+		}
+	}
+}
+
+func (m *streamMember) recv() (post, error) {
+	select {
+	case msg := <-m.incoming:
+		return post{text: msg.GetText(), ref: msg.Ref}, nil
+	case err := <-m.recvErr:
+		return post{}, err
+	case <-m.stopped:
+		return post{}, io.EOF
+	}
+}
+
+func (m *streamMember) stopRecv() {
+	m.stopOnce.Do(func() { close(m.stopped) })
+}
+
+func (m *streamMember) send(msg message) error {
+	out := &butlerpb.ChatServerMessage{Id: msg.id, Seq: msg.seq, SentAt: timestamppb.New(msg.timestamp())}
+	switch msg.kind {
+	case chatMessage:
+		out.Sender, out.Text, out.Replayed = msg.sender, msg.text, msg.replayed
+	case systemMessage:
+		out.Text, out.System = msg.text, true
+	case ackMessage:
+		out.AckRef = msg.ref
+	default:
+		line, ok := msg.line()
+		if !ok {
+			return nil
+		}
+		out.Text, out.System = strings.TrimPrefix(line, systemPrefix), msg.kind == errorMessage
+	}
+	return m.stream.Send(out)
+}
+
+// setReadDeadline does nothing, the stream's first message is read before
+// the member is created.
+func (m *streamMember) setReadDeadline(t time.Time) {}
+
+// setWriteDeadline does nothing, a stream can only be written to until its
+// context is done. gRPC flow control limits how much a slow client buffers.
+func (m *streamMember) setWriteDeadline(t time.Time) {}
+
+func (m *streamMember) remoteAddr() string {
+	return m.addr
+}
+
+func (m *streamMember) tlsState() *tls.ConnectionState {
+	return peerTLSState(m.stream.Context())
+}
+
+// Join lets a client take part in a room over its gRPC connection. The
+// members joined this way share the room with the ones connected to the
+// room port.
+func (b *Butler) Join(stream butlerpb.Chat_JoinServer) (err error) {
+	msg, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	// serve only fails for members that couldn't join, so every error from
+	// here on turns the client away
+	defer func() {
+		if err != nil {
+			b.metrics.rejectedConn(err)
+		}
+	}()
+	join := msg.GetJoin()
+	if join == nil {
+		return errInvalidArgument("payload", "first message must be a join request")
+	}
+	if b.isClosing() {
+		return errShuttingDown()
+	}
+
+	if join.RoomId == "" {
+		join.RoomId, _ = roomOfTicket(join.Ticket)
+	}
+	cr, ok := b.findRoomByID(join.RoomId)
+	if !ok {
+		return errRoomNotFound(join.RoomId)
+	}
+
+	var addr string
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		addr = p.Addr.String()
+	}
+	if !cr.checkPassword(join.Password) {
+		log.Printf("%s (%s) failed to enter room \"%s\": invalid password", join.Name, addr, cr.name)
+		return errInvalidPassword(cr.name)
+	}
+
+	m := newStreamMember(stream, addr)
+	defer m.stopRecv()
+	id, err := cr.identify(m.tlsState(), join.Token, join.Name)
+	if err == nil {
+		err = cr.checkTicket(join.Ticket, id)
+	}
+	if err != nil {
+		log.Printf("%s (%s) failed to enter room \"%s\": %s", join.Name, addr, cr.name, err)
+		return err
+	}
+
+	log.Printf("new stream connection in room %s is %s", cr.id, id.name)
+	return cr.serve(id, m)
+}
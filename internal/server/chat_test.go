@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/dimaglushkov/go-chat/api/butlerpb"
+)
+
+func joinStream(t *testing.T, chat butlerpb.ChatClient, join *butlerpb.ChatJoin) butlerpb.Chat_JoinClient {
+	stream, err := chat.Join(context.Background())
+	require.NoError(t, err)
+	err = stream.Send(&butlerpb.ChatClientMessage{Payload: &butlerpb.ChatClientMessage_Join{Join: join}})
+	require.NoError(t, err)
+	return stream
+}
+
+func TestButler_JoinMixedTransports(t *testing.T) {
+	butler := NewButler(Config{})
+	conn := startButler(t, &butler)
+	addr := serveRooms(t, &butler)
+	chat := butlerpb.NewChatClient(conn)
+
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "mixed", Size: 5})
+	require.NoError(t, err)
+
+	stream := joinStream(t, chat, &butlerpb.ChatJoin{RoomId: ref.Id, Name: "grpcUser"})
+	msg, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "grpcUser joined", msg.Text)
+
+	tcpUser := joinTestClient(t, addr, ref, "tcpUser")
+	msg, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "tcpUser joined", msg.Text)
+
+	tcpUser.say(t, "hello from tcp")
+	msg, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "tcpUser", msg.Sender)
+	assert.Equal(t, "hello from tcp", msg.Text)
+
+	err = stream.Send(&butlerpb.ChatClientMessage{Payload: &butlerpb.ChatClientMessage_Text{Text: "hello from grpc"}})
+	require.NoError(t, err)
+	tcpUser.expect(t, "grpcUser: hello from grpc")
+
+	require.NoError(t, stream.CloseSend())
+	tcpUser.expect(t, "grpcUser left")
+}
+
+func TestButler_JoinRejected(t *testing.T) {
+	butler := NewButler(Config{})
+	chat := butlerpb.NewChatClient(startButler(t, &butler))
+
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "locked", Size: 5, Password: "pass"})
+	require.NoError(t, err)
+
+	stream := joinStream(t, chat, &butlerpb.ChatJoin{RoomId: "missing", Name: "user"})
+	_, err = stream.Recv()
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	stream = joinStream(t, chat, &butlerpb.ChatJoin{RoomId: ref.Id, Name: "user", Password: "wrong"})
+	_, err = stream.Recv()
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestButler_JoinQuitCommand(t *testing.T) {
+	butler := NewButler(Config{})
+	chat := butlerpb.NewChatClient(startButler(t, &butler))
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "quitting", Size: 5})
+	require.NoError(t, err)
+
+	stream := joinStream(t, chat, &butlerpb.ChatJoin{RoomId: ref.Id, Name: "grpcUser"})
+	_, err = stream.Recv()
+	require.NoError(t, err)
+
+	err = stream.Send(&butlerpb.ChatClientMessage{Payload: &butlerpb.ChatClientMessage_Text{Text: "/quit"}})
+	require.NoError(t, err)
+	msg, err := stream.Recv()
+	require.NoError(t, err)
+	assert.True(t, msg.System)
+	assert.Equal(t, "bye", msg.Text)
+	_, err = stream.Recv()
+	assert.ErrorIs(t, err, io.EOF)
+}
@@ -0,0 +1,286 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// activeLogName is the file a room appends its records to. It is
+	// renamed to a segment named after the time of the rotation once it
+	// grows too large or the room closes.
+	activeLogName = "chat.log"
+	segmentPrefix = "chat-"
+	segmentSuffix = ".log"
+	// segmentTimeLayout sorts segments in the order they were written.
+	segmentTimeLayout = "20060102T150405.000000000Z"
+
+	// logBufferSize is the number of records a room can get ahead of its
+	// log writer before its monitor has to wait for the disk.
+	logBufferSize = 256
+)
+
+// LogConfig sets up the append-only logs rooms keep on disk. Every room writes
+// to a directory named after its id, one JSON record per line.
+type LogConfig struct {
+	// Dir is the directory the room logs are kept in. Empty disables them.
+	Dir string
+	// MaxSize is the size in bytes a log file may grow to before it is
+	// rotated. Zero never rotates a file while its room is open.
+	MaxSize int64
+	// MaxAge is how long rotated log files are kept, see PruneLogs. Zero
+	// keeps them forever.
+	MaxAge time.Duration
+}
+
+// logRecord is a line of a room log.
+type logRecord struct {
+	Time   time.Time `json:"time"`
+	Room   string    `json:"room"`
+	Event  string    `json:"event"`
+	ID     string    `json:"id,omitempty"`
+	Seq    uint64    `json:"seq,omitempty"`
+	Sender string    `json:"sender,omitempty"`
+	Addr   string    `json:"addr,omitempty"`
+	Text   string    `json:"text,omitempty"`
+}
+
+// roomLog writes a room's records from a goroutine of its own, so the room
+// only waits for the disk when the writer falls behind. Every record is
+// written with a single append and synced before the writer goes idle, so a
+// crash loses at most the records that were still buffered and can leave at
+// most a single torn line at the end of the file.
+type roomLog struct {
+	cfg     LogConfig
+	dir     string
+	file    *os.File
+	size    int64
+	records chan logRecord
+	done    chan struct{}
+}
+
+func openRoomLog(cfg LogConfig, id string) (*roomLog, error) {
+	l := &roomLog{
+		cfg:     cfg,
+		dir:     filepath.Join(cfg.Dir, id),
+		records: make(chan logRecord, logBufferSize),
+		done:    make(chan struct{}),
+	}
+	if err := os.MkdirAll(l.dir, 0o700); err != nil {
+		return nil, fmt.Errorf("error while creating room log directory: %s", err)
+	}
+	if err := l.openActive(); err != nil {
+		return nil, err
+	}
+	go l.run()
+	return l, nil
+}
+
+func (l *roomLog) openActive() error {
+	file, err := os.OpenFile(filepath.Join(l.dir, activeLogName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("error while opening room log: %s", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("error while opening room log: %s", err)
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+// write queues rec to be appended to the log. It is a no-op on a nil log.
+func (l *roomLog) write(rec logRecord) {
+	if l == nil {
+		return
+	}
+	l.records <- rec
+}
+
+// close writes the queued records and turns the active file into a segment.
+// It is a no-op on a nil log.
+func (l *roomLog) close() {
+	if l == nil {
+		return
+	}
+	close(l.records)
+	<-l.done
+}
+
+func (l *roomLog) run() {
+	defer close(l.done)
+	for rec := range l.records {
+		l.append(rec)
+		// sync once for everything queued meanwhile
+	batch:
+		for {
+			select {
+			case rec, ok := <-l.records:
+				if !ok {
+					break batch
+				}
+				l.append(rec)
+			default:
+				break batch
+			}
+		}
+		if err := l.file.Sync(); err != nil {
+			log.Printf("error while syncing room log in %s: %s", l.dir, err)
+		}
+	}
+	if err := l.rotate(false); err != nil {
+		log.Printf("error while closing room log in %s: %s", l.dir, err)
+	}
+}
+
+func (l *roomLog) append(rec logRecord) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		log.Printf("error while encoding room log record: %s", err)
+		return
+	}
+	line = append(line, '\n')
+	if l.cfg.MaxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.cfg.MaxSize {
+		if err := l.rotate(true); err != nil {
+			log.Printf("error while rotating room log in %s: %s", l.dir, err)
+			return
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		log.Printf("error while writing room log in %s: %s", l.dir, err)
+	}
+}
+
+// rotate closes the active file and renames it to a new segment. If reopen is
+// set, a new active file is started.
+func (l *roomLog) rotate(reopen bool) error {
+	if l.file == nil {
+		return nil
+	}
+	syncErr := l.file.Sync()
+	if err := l.file.Close(); err != nil && syncErr == nil {
+		syncErr = err
+	}
+	l.file = nil
+	if syncErr != nil {
+		return syncErr
+	}
+	segment := segmentPrefix + time.Now().UTC().Format(segmentTimeLayout) + segmentSuffix
+	if err := os.Rename(filepath.Join(l.dir, activeLogName), filepath.Join(l.dir, segment)); err != nil {
+		return err
+	}
+	if err := syncDir(l.dir); err != nil {
+		return err
+	}
+	if reopen {
+		return l.openActive()
+	}
+	return nil
+}
+
+// syncDir makes a rename in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// RecoverLogs turns the active files left behind by rooms of a previous run,
+// e.g. one that crashed, into segments, so that PruneLogs deletes them once
+// they are old enough. Room ids are never reused, so nothing would rotate
+// them otherwise. It must be called before any room is created.
+func RecoverLogs(cfg LogConfig) error {
+	if cfg.Dir == "" {
+		return nil
+	}
+	rooms, err := os.ReadDir(cfg.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, room := range rooms {
+		if !room.IsDir() {
+			continue
+		}
+		dir := filepath.Join(cfg.Dir, room.Name())
+		info, err := os.Stat(filepath.Join(dir, activeLogName))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		// name the segment after the last write, so it sorts among the
+		// others the way it was written
+		segment := segmentPrefix + info.ModTime().UTC().Format(segmentTimeLayout) + segmentSuffix
+		if err := os.Rename(filepath.Join(dir, activeLogName), filepath.Join(dir, segment)); err != nil {
+			return err
+		}
+		if err := syncDir(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PruneLogs deletes the rotated room log files that were last written to more
+// than cfg.MaxAge ago, along with the room directories left empty. Active
+// files are never deleted, as their rooms may still be writing to them, see
+// RecoverLogs for the ones no room owns.
+func PruneLogs(cfg LogConfig) error {
+	if cfg.Dir == "" || cfg.MaxAge <= 0 {
+		return nil
+	}
+	cutoff := time.Now().Add(-cfg.MaxAge)
+	rooms, err := os.ReadDir(cfg.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, room := range rooms {
+		if !room.IsDir() {
+			continue
+		}
+		dir := filepath.Join(cfg.Dir, room.Name())
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		kept := len(files)
+		for _, file := range files {
+			name := file.Name()
+			if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+				continue
+			}
+			info, err := file.Info()
+			if err != nil {
+				return err
+			}
+			if info.ModTime().Before(cutoff) {
+				if err := os.Remove(filepath.Join(dir, name)); err != nil {
+					return err
+				}
+				kept--
+			}
+		}
+		if kept == 0 {
+			os.Remove(dir)
+		}
+	}
+	return nil
+}
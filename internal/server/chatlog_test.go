@@ -0,0 +1,190 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dimaglushkov/go-chat/api/butlerpb"
+	"github.com/dimaglushkov/go-chat/internal/wire"
+)
+
+// readLogs returns the records of a room's log files in the order they were
+// written.
+func readLogs(t *testing.T, dir string) []logRecord {
+	files, err := filepath.Glob(filepath.Join(dir, segmentPrefix+"*"+segmentSuffix))
+	require.NoError(t, err)
+	sort.Strings(files)
+	if _, err := os.Stat(filepath.Join(dir, activeLogName)); err == nil {
+		files = append(files, filepath.Join(dir, activeLogName))
+	}
+
+	var records []logRecord
+	for _, name := range files {
+		file, err := os.Open(name)
+		require.NoError(t, err)
+		input := bufio.NewScanner(file)
+		for input.Scan() {
+			var rec logRecord
+			require.NoError(t, json.Unmarshal(input.Bytes(), &rec))
+			records = append(records, rec)
+		}
+		file.Close()
+	}
+	return records
+}
+
+func TestRoomLog_Rotation(t *testing.T) {
+	cfg := LogConfig{Dir: t.TempDir(), MaxSize: 200}
+	l, err := openRoomLog(cfg, "room")
+	require.NoError(t, err)
+	for _, text := range []string{"one", "two", "three", "four", "five"} {
+		l.write(logRecord{Room: "rotating", Event: "chat", Sender: "alice", Text: text})
+	}
+	l.close()
+
+	dir := filepath.Join(cfg.Dir, "room")
+	segments, err := filepath.Glob(filepath.Join(dir, segmentPrefix+"*"))
+	require.NoError(t, err)
+	assert.Greater(t, len(segments), 1)
+	for _, segment := range segments {
+		info, err := os.Stat(segment)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, info.Size(), cfg.MaxSize)
+	}
+	_, err = os.Stat(filepath.Join(dir, activeLogName))
+	assert.True(t, os.IsNotExist(err), "closed log must have no active file")
+
+	var texts []string
+	for _, rec := range readLogs(t, dir) {
+		texts = append(texts, rec.Text)
+	}
+	assert.Equal(t, []string{"one", "two", "three", "four", "five"}, texts)
+}
+
+func TestPruneLogs(t *testing.T) {
+	cfg := LogConfig{Dir: t.TempDir(), MaxAge: 24 * time.Hour}
+	old := time.Now().Add(-48 * time.Hour)
+	for path, modTime := range map[string]time.Time{
+		"closed/chat-1.log": old,
+		"open/chat-1.log":   old,
+		"open/chat-2.log":   time.Now(),
+		"open/chat.log":     old,
+	} {
+		path = filepath.Join(cfg.Dir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		require.NoError(t, os.WriteFile(path, []byte("{}\n"), 0o600))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	require.NoError(t, PruneLogs(cfg))
+	_, err := os.Stat(filepath.Join(cfg.Dir, "closed"))
+	assert.True(t, os.IsNotExist(err), "directory without logs left must be removed")
+	left, err := os.ReadDir(filepath.Join(cfg.Dir, "open"))
+	require.NoError(t, err)
+	var names []string
+	for _, file := range left {
+		names = append(names, file.Name())
+	}
+	assert.Equal(t, []string{"chat-2.log", "chat.log"}, names)
+}
+
+func TestRecoverLogs(t *testing.T) {
+	cfg := LogConfig{Dir: t.TempDir(), MaxAge: 24 * time.Hour}
+	old := time.Now().Add(-48 * time.Hour)
+	for path, modTime := range map[string]time.Time{
+		"crashed/chat.log": old,
+		"recent/chat.log":  time.Now(),
+	} {
+		path = filepath.Join(cfg.Dir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		require.NoError(t, os.WriteFile(path, []byte("{}\n"), 0o600))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	// the active files of rooms that are gone become segments, which are
+	// pruned as usual
+	require.NoError(t, RecoverLogs(cfg))
+	require.NoError(t, PruneLogs(cfg))
+	_, err := os.Stat(filepath.Join(cfg.Dir, "crashed"))
+	assert.True(t, os.IsNotExist(err), "orphaned log past the retention period must be removed")
+	left, err := os.ReadDir(filepath.Join(cfg.Dir, "recent"))
+	require.NoError(t, err)
+	require.Len(t, left, 1)
+	assert.True(t, strings.HasPrefix(left[0].Name(), segmentPrefix), "got %s", left[0].Name())
+	assert.Len(t, readLogs(t, filepath.Join(cfg.Dir, "recent")), 1)
+}
+
+func TestRoom_Log(t *testing.T) {
+	dir := t.TempDir()
+	butler := NewButler(Config{Room: RoomConfig{Log: LogConfig{Dir: dir}}})
+	addr := serveRooms(t, &butler)
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "audited", Size: 5, Creator: "boss"})
+	require.NoError(t, err)
+
+	alice := joinTestClient(t, addr, ref, "alice")
+	alice.say(t, "for the record")
+	alice.say(t, "/me signs")
+	alice.expect(t, "* alice signs")
+	alice.say(t, "/who")
+	alice.expect(t, "*** 1 in the room: alice")
+	alice.conn.Close()
+	require.Eventually(t, func() bool {
+		_, ok := butler.findRoomByID(ref.Id)
+		return !ok
+	}, 3*time.Second, 10*time.Millisecond)
+
+	var events []string
+	for _, rec := range readLogs(t, filepath.Join(dir, ref.Id)) {
+		assert.Equal(t, "audited", rec.Room)
+		assert.False(t, rec.Time.IsZero())
+		events = append(events, rec.Event+" "+rec.Sender+" "+rec.Text)
+	}
+	assert.Equal(t, []string{
+		"open boss ",
+		"join alice ",
+		"chat alice for the record",
+		"notice  * alice signs",
+		"leave alice ",
+		"close  last client left",
+	}, events)
+}
+
+func TestButler_ShutdownLog(t *testing.T) {
+	dir := t.TempDir()
+	butler := NewButler(Config{Room: RoomConfig{Log: LogConfig{Dir: dir}}})
+	addr := serveRooms(t, &butler)
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "audited", Size: 5, Creator: "boss"})
+	require.NoError(t, err)
+	alice := joinTestClient(t, addr, ref, "alice")
+	alice.send(t, wire.Frame{Type: wire.TypeChat, Text: "last words", Ref: "1"})
+	assert.Equal(t, wire.TypeAck, alice.next(t).Type)
+
+	require.NoError(t, butler.Shutdown(context.Background(), "going down"))
+
+	// the log is rotated to a segment by the time Shutdown returns
+	roomDir := filepath.Join(dir, ref.Id)
+	_, err = os.Stat(filepath.Join(roomDir, activeLogName))
+	assert.True(t, os.IsNotExist(err), "active log left behind: %v", err)
+	var events []string
+	for _, rec := range readLogs(t, roomDir) {
+		events = append(events, rec.Event+" "+rec.Sender+" "+rec.Text)
+	}
+	assert.Equal(t, []string{
+		"open boss ",
+		"join alice ",
+		"chat alice last words",
+		"notice  going down",
+		"leave alice ",
+		"close  server shutting down",
+	}, events)
+}
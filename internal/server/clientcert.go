@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// connTLSState returns the TLS state of conn, nil for plaintext connections.
+func connTLSState(conn net.Conn) *tls.ConnectionState {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	state := tlsConn.ConnectionState()
+	return &state
+}
+
+// peerTLSState returns the TLS state of the gRPC peer of ctx, nil for
+// plaintext connections.
+func peerTLSState(ctx context.Context) *tls.ConnectionState {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
+	}
+	return &info.State
+}
+
+// clientCert returns the client certificate verified during the handshake of
+// state, nil if the client presented none or it wasn't verified.
+func clientCert(state *tls.ConnectionState) *x509.Certificate {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
+
+// certName returns the user name a client certificate is issued to: the
+// common name of its subject, or else the user part of its first email
+// address or its first DNS name.
+func certName(cert *x509.Certificate) string {
+	switch {
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.EmailAddresses) > 0:
+		user, _, _ := strings.Cut(cert.EmailAddresses[0], "@")
+		return user
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	}
+	return ""
+}
+
+// identify tells who a member connected with state joins the room as. The
+// name in a verified client certificate takes precedence over the token and
+// the name the member sent.
+func (r *room) identify(state *tls.ConnectionState, token, name string) (identity, error) {
+	if cert := clientCert(state); cert != nil {
+		return identity{name: certName(cert), loggedIn: true}, nil
+	}
+	if r.cfg.RequireClientCerts {
+		return identity{}, errUnauthenticated("a client certificate is required to join rooms")
+	}
+	return r.accounts.identify(token, name)
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/status"
+)
+
+// Command is a slash command clients can run inside a room by sending a line
+// starting with "/" followed by the command name. Commands are run by the
+// room's monitor, so they must not block.
+type Command interface {
+	// Name is the name the command is invoked by, without the slash.
+	Name() string
+	// Usage shows the command's arguments, e.g. "/nick <name>".
+	Usage() string
+	Help() string
+	Run(ctx *CommandContext, args string)
+}
+
+// CommandContext gives a running command access to the room it was invoked
+// in and to the client that invoked it.
+type CommandContext struct {
+	room   *room
+	client *client
+}
+
+// Sender returns the current name of the client that ran the command.
+func (ctx *CommandContext) Sender() string {
+	return ctx.client.name
+}
+
+// Reply sends a system message to the client that ran the command only.
+func (ctx *CommandContext) Reply(format string, a ...any) {
+	ctx.room.deliver(ctx.client, message{kind: systemMessage, text: fmt.Sprintf(format, a...)})
+}
+
+// Broadcast sends a notice to every client in the room. Notices are kept in
+// the room's history and log like messages.
+func (ctx *CommandContext) Broadcast(format string, a ...any) {
+	msg := ctx.room.stamp(message{text: fmt.Sprintf(format, a...)})
+	ctx.room.broadcast(msg)
+	ctx.room.remember(msg)
+	ctx.room.record("notice", msg, "")
+}
+
+// Members returns the names of the room's clients in alphabetical order.
+func (ctx *CommandContext) Members() []string {
+	return ctx.room.presence().members
+}
+
+// Commands returns the commands available in the room ordered by name.
+func (ctx *CommandContext) Commands() []Command {
+	return ctx.room.commands.sorted()
+}
+
+func (ctx *CommandContext) Topic() string {
+	return ctx.room.topic
+}
+
+func (ctx *CommandContext) SetTopic(topic string) {
+	ctx.room.topic = topic
+}
+
+// SetNick renames the client that ran the command. The name must follow the
+// room's nickname policy and must not be used by anybody else in the room.
+// Clients that logged in keep the name of their account, guests keep their
+// marker.
+func (ctx *CommandContext) SetNick(name string) error {
+	if ctx.client.loggedIn {
+		return errors.New("logged in users keep the name of their account")
+	}
+	if err := ctx.room.checkNickname(name, ctx.client); err != nil {
+		return errors.New(status.Convert(err).Message())
+	}
+	ctx.client.name = ctx.client.displayName(name)
+	ctx.room.broadcast(ctx.room.presence())
+	return nil
+}
+
+// Quit makes the client that ran the command leave the room. Replies sent
+// before are still delivered.
+func (ctx *CommandContext) Quit() {
+	ctx.client.member.stopRecv()
+}
+
+// commandSet maps command names to commands. Sets are never modified once
+// built, so rooms can share them without locking.
+type commandSet map[string]Command
+
+func newCommandSet(commands ...Command) commandSet {
+	set := make(commandSet, len(commands))
+	for _, cmd := range commands {
+		set[cmd.Name()] = cmd
+	}
+	return set
+}
+
+// with returns a copy of the set extended with cmd.
+func (set commandSet) with(cmd Command) commandSet {
+	extended := make(commandSet, len(set)+1)
+	for name, c := range set {
+		extended[name] = c
+	}
+	extended[cmd.Name()] = cmd
+	return extended
+}
+
+func (set commandSet) sorted() []Command {
+	commands := make([]Command, 0, len(set))
+	for _, cmd := range set {
+		commands = append(commands, cmd)
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Name() < commands[j].Name()
+	})
+	return commands
+}
+
+var builtinCommands = newCommandSet(
+	helpCommand{},
+	whoCommand{},
+	nickCommand{},
+	meCommand{},
+	topicCommand{},
+	quitCommand{},
+)
+
+// isCommand reports whether a line sent by a client is a command. Lines
+// starting with "//" are regular messages starting with a single slash.
+func isCommand(text string) bool {
+	return strings.HasPrefix(text, "/") && !strings.HasPrefix(text, "//")
+}
+
+func unescapeCommand(text string) string {
+	if strings.HasPrefix(text, "//") {
+		return text[1:]
+	}
+	return text
+}
+
+func (r *room) runCommand(p post) {
+	name, args, _ := strings.Cut(strings.TrimPrefix(p.text, "/"), " ")
+	ctx := &CommandContext{room: r, client: p.from}
+	cmd, ok := r.commands[name]
+	if !ok {
+		ctx.Reply("unknown command /%s, see /help", name)
+		return
+	}
+	cmd.Run(ctx, strings.TrimSpace(args))
+}
+
+// RegisterCommand makes cmd available in the rooms created from now on. A
+// command with the same name as an existing one replaces it.
+func (b *Butler) RegisterCommand(cmd Command) {
+	b.mu.Lock()
+	b.commands = b.commands.with(cmd)
+	b.mu.Unlock()
+}
+
+type helpCommand struct{}
+
+func (helpCommand) Name() string  { return "help" }
+func (helpCommand) Usage() string { return "/help" }
+func (helpCommand) Help() string  { return "list available commands" }
+
+func (helpCommand) Run(ctx *CommandContext, args string) {
+	for _, cmd := range ctx.Commands() {
+		ctx.Reply("%s - %s", cmd.Usage(), cmd.Help())
+	}
+}
+
+type whoCommand struct{}
+
+func (whoCommand) Name() string  { return "who" }
+func (whoCommand) Usage() string { return "/who" }
+func (whoCommand) Help() string  { return "list users in the room" }
+
+func (whoCommand) Run(ctx *CommandContext, args string) {
+	members := ctx.Members()
+	ctx.Reply("%d in the room: %s", len(members), strings.Join(members, ", "))
+}
+
+type nickCommand struct{}
+
+func (nickCommand) Name() string  { return "nick" }
+func (nickCommand) Usage() string { return "/nick <name>" }
+func (nickCommand) Help() string  { return "change your name" }
+
+func (nickCommand) Run(ctx *CommandContext, args string) {
+	oldName := ctx.Sender()
+	if err := ctx.SetNick(args); err != nil {
+		ctx.Reply("can't change name: %s", err)
+		return
+	}
+	ctx.Broadcast("%s is now known as %s", oldName, ctx.Sender())
+}
+
+type meCommand struct{}
+
+func (meCommand) Name() string  { return "me" }
+func (meCommand) Usage() string { return "/me <action>" }
+func (meCommand) Help() string  { return "describe what you are doing" }
+
+func (meCommand) Run(ctx *CommandContext, args string) {
+	if args == "" {
+		ctx.Reply("usage: /me <action>")
+		return
+	}
+	ctx.Broadcast("* %s %s", ctx.Sender(), args)
+}
+
+type topicCommand struct{}
+
+func (topicCommand) Name() string  { return "topic" }
+func (topicCommand) Usage() string { return "/topic [topic]" }
+func (topicCommand) Help() string  { return "show or change the room topic" }
+
+func (topicCommand) Run(ctx *CommandContext, args string) {
+	if args == "" {
+		if ctx.Topic() == "" {
+			ctx.Reply("no topic is set")
+		} else {
+			ctx.Reply("topic: %s", ctx.Topic())
+		}
+		return
+	}
+	ctx.SetTopic(args)
+	ctx.Broadcast("%s changed the topic to: %s", ctx.Sender(), args)
+}
+
+type quitCommand struct{}
+
+func (quitCommand) Name() string  { return "quit" }
+func (quitCommand) Usage() string { return "/quit" }
+func (quitCommand) Help() string  { return "leave the room" }
+
+func (quitCommand) Run(ctx *CommandContext, args string) {
+	ctx.Reply("bye")
+	ctx.Quit()
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/dimaglushkov/go-chat/api/butlerpb"
+	"github.com/dimaglushkov/go-chat/internal/wire"
+)
+
+type pingCommand struct{}
+
+func (pingCommand) Name() string  { return "ping" }
+func (pingCommand) Usage() string { return "/ping" }
+func (pingCommand) Help() string  { return "reply with pong" }
+
+func (pingCommand) Run(ctx *CommandContext, args string) {
+	ctx.Reply("pong")
+}
+
+func TestRoom_Commands(t *testing.T) {
+	butler := NewButler(Config{})
+	butler.RegisterCommand(pingCommand{})
+	addr := serveRooms(t, &butler)
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "commands", Size: 5})
+	require.NoError(t, err)
+
+	alice := joinTestClient(t, addr, ref, "alice")
+	bob := joinTestClient(t, addr, ref, "bob")
+	alice.expect(t, "bob joined")
+
+	// replies go to the caller only, the next line bob reads is alice's message
+	alice.say(t, "/who")
+	alice.expect(t, "*** 2 in the room: alice, bob")
+	alice.say(t, "/ping")
+	alice.expect(t, "*** pong")
+	alice.say(t, "/unknown")
+	alice.expect(t, "*** unknown command /unknown, see /help")
+	alice.say(t, "//not a command")
+	bob.expect(t, "alice: /not a command")
+
+	alice.say(t, "/help")
+	for _, cmd := range []string{"help", "me", "nick", "ping", "quit", "topic", "who"} {
+		alice.expect(t, fmt.Sprintf("*** %s - %s", butler.commands[cmd].Usage(), butler.commands[cmd].Help()))
+	}
+
+	bob.say(t, "/me waves")
+	alice.expect(t, "* bob waves")
+	bob.expect(t, "* bob waves")
+
+	bob.say(t, "/topic")
+	bob.expect(t, "*** no topic is set")
+	bob.say(t, "/topic release")
+	alice.expect(t, "bob changed the topic to: release")
+	bob.expect(t, "bob changed the topic to: release")
+	alice.say(t, "/topic")
+	alice.expect(t, "*** topic: release")
+
+	bob.say(t, "/nick robert")
+	alice.expect(t, "presence frame")
+	bob.expect(t, "presence frame")
+	alice.expect(t, "bob is now known as robert")
+	bob.expect(t, "bob is now known as robert")
+	bob.say(t, "hi")
+	alice.expect(t, "robert: hi")
+
+	alice.say(t, "/quit")
+	alice.expect(t, "*** bye")
+	bob.expect(t, "alice left")
+}
+
+func TestRoom_UniqueNicknames(t *testing.T) {
+	butler := NewButler(Config{})
+	addr := serveRooms(t, &butler)
+	chat := butlerpb.NewChatClient(startButler(t, &butler))
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "nicknames", Size: 5})
+	require.NoError(t, err)
+
+	alice := joinTestClient(t, addr, ref, "alice")
+	bob := joinTestClient(t, addr, ref, "bob")
+	alice.expect(t, "bob joined")
+
+	for name, reason := range map[string]string{
+		"Alice":     `*** rejected: user name "Alice" is already taken in this room`,
+		"":          "*** rejected: invalid name: user name must be 1 to 20 characters long",
+		"two words": `*** rejected: invalid name: user name must match ^[\p{L}\p{N}_.\-]+$`,
+	} {
+		c := dialRoom(t, addr, wire.Frame{Room: ref.Id, Name: name})
+		assert.Equal(t, wire.TypeHello, c.next(t).Type)
+		c.expect(t, reason)
+		c.expectClosed(t)
+	}
+
+	stream := joinStream(t, chat, &butlerpb.ChatJoin{RoomId: ref.Id, Name: "bob"})
+	_, err = stream.Recv()
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	bob.say(t, "/nick ALICE")
+	bob.expect(t, `*** can't change name: user name "ALICE" is already taken in this room`)
+	bob.say(t, "/nick Bob")
+	alice.expect(t, "presence frame")
+	bob.expect(t, "presence frame")
+	alice.expect(t, "bob is now known as Bob")
+	bob.expect(t, "bob is now known as Bob")
+
+	// messages are routed by connection, so the sender still gets nothing back
+	alice.say(t, "hi")
+	bob.expect(t, "alice: hi")
+	bob.say(t, "hello")
+	alice.expect(t, "Bob: hello")
+}
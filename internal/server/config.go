@@ -0,0 +1,66 @@
+package server
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Config holds the server-wide settings of a Butler. The zero value is usable
+// and keeps every optional behavior disabled.
+type Config struct {
+	Room      RoomConfig
+	RoomNames NamePolicy
+	Accounts  AccountConfig
+	// Metrics is the registry the server's Prometheus metrics are
+	// registered with. Nil disables metrics.
+	Metrics prometheus.Registerer
+}
+
+// defaultMaxMessageSize is the length in bytes of the longest message rooms
+// accept when RoomConfig.MaxMessageSize isn't set.
+const defaultMaxMessageSize = 4 << 10
+
+// RoomConfig holds the settings every room is created with.
+type RoomConfig struct {
+	// JoinTimeout closes a room nobody has joined within this time after its
+	// creation. Zero keeps unjoined rooms open.
+	JoinTimeout time.Duration
+	// IdleTimeout is how long a room stays open after its last client
+	// leaves. Zero closes it right away.
+	IdleTimeout time.Duration
+	// Nicknames is the policy the names of the room's clients must follow.
+	Nicknames NamePolicy
+	// HistorySize is the number of messages a room keeps to replay to the
+	// clients joining it. Zero disables the history.
+	HistorySize int
+	// HistoryAge is how long messages are kept in the history. Zero keeps
+	// them until they are pushed out by newer ones.
+	HistoryAge time.Duration
+	// Log sets up the logs rooms keep on disk.
+	Log LogConfig
+	// QueueSize is the number of messages a client may fall behind before
+	// Overflow applies. Zero means 256.
+	QueueSize int
+	// Overflow tells what happens to the messages of a client whose queue
+	// is full.
+	Overflow OverflowPolicy
+	// WriteTimeout is how long a message may take to be written to a
+	// client before it is disconnected. Zero waits forever.
+	WriteTimeout time.Duration
+	// MaxMessageSize is the length in bytes of the longest message clients
+	// may send. Zero means 4 KiB. Transports can't read lines longer than
+	// wire.MaxFrameSize whatever the setting.
+	MaxMessageSize int
+	// Limits are the rate limits of the room's clients. Rooms can be
+	// created with stricter ones.
+	Limits RateLimits
+	// RequireClientCerts only lets in the clients that connect with a
+	// verified TLS client certificate. Clients that have one always join
+	// under the name it is issued to, see certName.
+	RequireClientCerts bool
+	// RequireTickets only lets in the clients presenting a join ticket
+	// from FindRoom or CreateRoom, so rooms can't be joined by guessing or
+	// scanning for their ids.
+	RequireTickets bool
+}
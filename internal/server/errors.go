@@ -0,0 +1,116 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/runtime/protoiface"
+
+	"github.com/dimaglushkov/go-chat/internal/wire"
+)
+
+const roomResourceType = "room"
+
+func statusWithDetails(code codes.Code, msg string, details ...protoiface.MessageV1) error {
+	st := status.New(code, msg)
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+func errRoomExists(name string) error {
+	return statusWithDetails(codes.AlreadyExists, fmt.Sprintf("room \"%s\" already exists", name),
+		&errdetails.ResourceInfo{ResourceType: roomResourceType, ResourceName: name})
+}
+
+func errRoomNotFound(name string) error {
+	return statusWithDetails(codes.NotFound, fmt.Sprintf("room \"%s\" does not exist", name),
+		&errdetails.ResourceInfo{ResourceType: roomResourceType, ResourceName: name})
+}
+
+func errInvalidPassword(name string) error {
+	return statusWithDetails(codes.PermissionDenied, fmt.Sprintf("invalid password for room \"%s\"", name),
+		&errdetails.ResourceInfo{ResourceType: roomResourceType, ResourceName: name})
+}
+
+func errInvalidTicket(description string) error {
+	return status.Error(codes.PermissionDenied, description)
+}
+
+func errRoomClosed(name string) error {
+	return statusWithDetails(codes.Unavailable, fmt.Sprintf("room \"%s\" is closed", name),
+		&errdetails.ResourceInfo{ResourceType: roomResourceType, ResourceName: name})
+}
+
+func errShuttingDown() error {
+	return status.Error(codes.Unavailable, "server is shutting down")
+}
+
+func errNicknameTaken(name string) error {
+	return statusWithDetails(codes.AlreadyExists, fmt.Sprintf("user name \"%s\" is already taken in this room", name),
+		&errdetails.ResourceInfo{ResourceType: "user", ResourceName: name})
+}
+
+func errNameRegistered(name string) error {
+	return statusWithDetails(codes.Unauthenticated, fmt.Sprintf("user name \"%s\" is registered, log in to use it", name),
+		&errdetails.ResourceInfo{ResourceType: "user", ResourceName: name})
+}
+
+func errAccountExists(name string) error {
+	return statusWithDetails(codes.AlreadyExists, fmt.Sprintf("account \"%s\" already exists", name),
+		&errdetails.ResourceInfo{ResourceType: "account", ResourceName: name})
+}
+
+func errAccountsDisabled() error {
+	return status.Error(codes.Unimplemented, "this server has no accounts")
+}
+
+func errUnauthenticated(description string) error {
+	return status.Error(codes.Unauthenticated, description)
+}
+
+func errSlowClient(queued int) error {
+	return errResourceExhausted("client", fmt.Sprintf("disconnected for falling %d messages behind", queued))
+}
+
+func errMessageTooLong(max int) error {
+	return errInvalidArgument("text", fmt.Sprintf("message is longer than %d bytes", max))
+}
+
+func errRateLimited(subject, what string) error {
+	return errResourceExhausted(subject, fmt.Sprintf("slow down, too many %s sent", what))
+}
+
+func errMuted(d time.Duration) error {
+	return errResourceExhausted("client", fmt.Sprintf("muted for flooding the room, wait %s", d.Round(time.Second)))
+}
+
+func errFlooding() error {
+	return errResourceExhausted("client", "disconnected for flooding the room")
+}
+
+func errUnsupportedVersion(version int) error {
+	return status.Errorf(codes.Unimplemented, "protocol version %d is not supported, the server speaks version %d", version, wire.Version)
+}
+
+func errInvalidArgument(field, description string) error {
+	return statusWithDetails(codes.InvalidArgument, fmt.Sprintf("invalid %s: %s", field, description),
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: field, Description: description},
+		}})
+}
+
+func errResourceExhausted(subject, description string) error {
+	return statusWithDetails(codes.ResourceExhausted, description,
+		&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{
+			{Subject: subject, Description: description},
+		}})
+}
+
+func errInternal(format string, a ...any) error {
+	return status.Errorf(codes.Internal, format, a...)
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/dimaglushkov/go-chat/internal/wire"
+)
+
+// member is a room client's connection, independent of the transport it uses.
+// recv and send may be called concurrently with each other.
+type member interface {
+	// recv returns the next post sent by the client, its sender is left
+	// for the caller to fill in.
+	recv() (post, error)
+	send(msg message) error
+	// stopRecv makes pending and future recv calls fail, so the client
+	// leaves the room, while send keeps working.
+	stopRecv()
+	// setReadDeadline makes recv fail if nothing has been received by t.
+	setReadDeadline(t time.Time)
+	// setWriteDeadline makes send fail if it hasn't completed by t.
+	setWriteDeadline(t time.Time)
+	remoteAddr() string
+	// tlsState returns the state of the TLS connection of the client, nil
+	// if it isn't secured with TLS.
+	tlsState() *tls.ConnectionState
+}
+
+// lineMember speaks the plain-text protocol over a raw connection: every line
+// the client sends is a message and every event is rendered as a line.
+type lineMember struct {
+	conn  net.Conn
+	input *bufio.Reader
+}
+
+func newLineMember(conn net.Conn, rd io.Reader) *lineMember {
+	return &lineMember{conn: conn, input: bufio.NewReader(rd)}
+}
+
+func (m *lineMember) recv() (post, error) {
+	line, err := wire.ReadLine(m.input, wire.MaxFrameSize)
+	if errors.Is(err, wire.ErrLineTooLong) {
+		return post{tooLong: true}, nil
+	}
+	return post{text: string(line)}, err
+}
+
+func (m *lineMember) send(msg message) error {
+	line, ok := msg.line()
+	if !ok {
+		return nil
+	}
+	_, err := fmt.Fprintln(m.conn, line)
+	return err
+}
+
+func (m *lineMember) stopRecv() {
+	m.conn.SetReadDeadline(time.Now())
+}
+
+func (m *lineMember) setReadDeadline(t time.Time) {
+	m.conn.SetReadDeadline(t)
+}
+
+func (m *lineMember) setWriteDeadline(t time.Time) {
+	m.conn.SetWriteDeadline(t)
+}
+
+func (m *lineMember) remoteAddr() string {
+	return m.conn.RemoteAddr().String()
+}
+
+func (m *lineMember) tlsState() *tls.ConnectionState {
+	return connTLSState(m.conn)
+}
+
+// frameMember speaks the framed protocol of package wire over a raw
+// connection.
+type frameMember struct {
+	conn  net.Conn
+	input *wire.Reader
+}
+
+func newFrameMember(conn net.Conn, rd io.Reader) *frameMember {
+	return &frameMember{conn: conn, input: wire.NewReader(rd)}
+}
+
+// recv returns the text of the next chat frame. Frames that are invalid or
+// make no sense after the handshake, and frames that are too large, are left
+// for the room to reject.
+func (m *frameMember) recv() (post, error) {
+	f, err := m.input.Read()
+	var invalid *wire.InvalidFrameError
+	switch {
+	case errors.As(err, &invalid):
+		return post{invalid: errInvalidArgument("frame", invalid.Error())}, nil
+	case errors.Is(err, wire.ErrFrameTooLarge):
+		return post{tooLong: true}, nil
+	case err != nil:
+		return post{}, err
+	case f.Type != wire.TypeChat:
+		return post{ref: f.Ref, invalid: errInvalidArgument("frame", fmt.Sprintf("unexpected %s frame", f.Type))}, nil
+	}
+	return post{text: f.Text, ref: f.Ref}, nil
+}
+
+func (m *frameMember) send(msg message) error {
+	return wire.Write(m.conn, msg.frame())
+}
+
+func (m *frameMember) stopRecv() {
+	m.conn.SetReadDeadline(time.Now())
+}
+
+func (m *frameMember) setReadDeadline(t time.Time) {
+	m.conn.SetReadDeadline(t)
+}
+
+func (m *frameMember) setWriteDeadline(t time.Time) {
+	m.conn.SetWriteDeadline(t)
+}
+
+func (m *frameMember) remoteAddr() string {
+	return m.conn.RemoteAddr().String()
+}
+
+func (m *frameMember) tlsState() *tls.ConnectionState {
+	return connTLSState(m.conn)
+}
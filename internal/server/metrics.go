@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// metricsNamespace prefixes the names of the server's metrics.
+const metricsNamespace = "gochat"
+
+// metrics are the Prometheus metrics of a Butler and its rooms. A nil
+// *metrics is a server without metrics, all of its methods do nothing then.
+type metrics struct {
+	rooms    prometheus.Gauge
+	clients  *prometheus.GaugeVec
+	messages prometheus.Counter
+	bytes    prometheus.Counter
+	joins    prometheus.Counter
+	leaves   prometheus.Counter
+	rejected *prometheus.CounterVec
+	requests *prometheus.CounterVec
+	fanOut   prometheus.Histogram
+}
+
+// newMetrics registers the metrics with reg, it returns nil if reg is nil.
+func newMetrics(reg prometheus.Registerer) *metrics {
+	if reg == nil {
+		return nil
+	}
+	m := &metrics{
+		rooms: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "rooms_open",
+			Help:      "Number of open rooms.",
+		}),
+		clients: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "room_clients",
+			Help:      "Number of clients in each open room.",
+		}, []string{"room"}),
+		messages: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "messages_total",
+			Help:      "Chat messages sent to rooms, commands and rejected messages excluded.",
+		}),
+		bytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "message_bytes_total",
+			Help:      "Bytes of the chat messages sent to rooms.",
+		}),
+		joins: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "joins_total",
+			Help:      "Clients admitted to rooms.",
+		}),
+		leaves: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "leaves_total",
+			Help:      "Clients that left rooms, evicted ones included.",
+		}),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "rejected_connections_total",
+			Help:      "Connections turned away before joining a room, by gRPC status code.",
+		}, []string{"code"}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "butler_requests_total",
+			Help:      "Finished gRPC requests of the Butler and Chat services, by method and status code.",
+		}, []string{"service", "method", "code"}),
+		fanOut: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "broadcast_fan_out_seconds",
+			Help:      "Time rooms take to queue a message for all of its recipients.",
+			// 10µs to about 2.6s
+			Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10),
+		}),
+	}
+	reg.MustRegister(m.rooms, m.clients, m.messages, m.bytes, m.joins, m.leaves, m.rejected, m.requests, m.fanOut)
+	return m
+}
+
+func (m *metrics) roomOpened() {
+	if m != nil {
+		m.rooms.Inc()
+	}
+}
+
+// roomClosed drops the client count of the room called name, so that closed
+// rooms don't linger in the metrics.
+func (m *metrics) roomClosed(name string) {
+	if m != nil {
+		m.rooms.Dec()
+		m.clients.DeleteLabelValues(name)
+	}
+}
+
+func (m *metrics) setClients(room string, n int) {
+	if m != nil {
+		m.clients.WithLabelValues(room).Set(float64(n))
+	}
+}
+
+func (m *metrics) sent(text string) {
+	if m != nil {
+		m.messages.Inc()
+		m.bytes.Add(float64(len(text)))
+	}
+}
+
+func (m *metrics) joined() {
+	if m != nil {
+		m.joins.Inc()
+	}
+}
+
+func (m *metrics) left() {
+	if m != nil {
+		m.leaves.Inc()
+	}
+}
+
+// rejectedConn counts a connection turned away with err.
+func (m *metrics) rejectedConn(err error) {
+	if m != nil {
+		m.rejected.WithLabelValues(status.Code(err).String()).Inc()
+	}
+}
+
+func (m *metrics) fannedOut(d time.Duration) {
+	if m != nil {
+		m.fanOut.Observe(d.Seconds())
+	}
+}
+
+// request counts a finished request to fullMethod, a gRPC method name of the
+// form /package.Service/Method.
+func (m *metrics) request(fullMethod string, err error) {
+	if m == nil {
+		return
+	}
+	service, method := "", strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndexByte(method, '/'); i >= 0 {
+		service, method = method[:i], method[i+1:]
+	}
+	if i := strings.LastIndexByte(service, '.'); i >= 0 {
+		service = service[i+1:]
+	}
+	m.requests.WithLabelValues(service, method, status.Code(err).String()).Inc()
+}
+
+// UnaryInterceptor returns a gRPC interceptor counting the Butler's unary
+// requests in the metrics of Config.Metrics.
+func (b *Butler) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		b.metrics.request(info.FullMethod, err)
+		return resp, err
+	}
+}
+
+// StreamInterceptor is UnaryInterceptor for streaming requests, such as
+// Chat.Join, which are counted once they end.
+func (b *Butler) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, ss)
+		b.metrics.request(info.FullMethod, err)
+		return err
+	}
+}
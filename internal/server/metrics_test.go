@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/dimaglushkov/go-chat/api/butlerpb"
+)
+
+// fanOuts returns the number of broadcasts recorded in reg.
+func fanOuts(t *testing.T, reg *prometheus.Registry) uint64 {
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == "gochat_broadcast_fan_out_seconds" {
+			return family.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+	return 0
+}
+
+func TestButler_Metrics(t *testing.T) {
+	ctx := context.Background()
+	reg := prometheus.NewRegistry()
+	butler := NewButler(Config{Metrics: reg})
+	addr := serveRooms(t, &butler)
+	conn := startButler(t, &butler)
+	client := butlerpb.NewButlerClient(conn)
+	chat := butlerpb.NewChatClient(conn)
+	m := butler.metrics
+
+	ref, err := client.CreateRoom(ctx, &butlerpb.RoomNameSize{Name: "metrics", Size: 5})
+	require.NoError(t, err)
+	_, err = client.FindRoom(ctx, &butlerpb.RoomName{Name: "nowhere"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues("Butler", "CreateRoom", "OK")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues("Butler", "FindRoom", "NotFound")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.rooms))
+
+	alice := joinTestClient(t, addr, ref, "alice")
+	bob := joinTestClient(t, addr, ref, "bob")
+	alice.expect(t, "bob joined")
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.clients.WithLabelValues("metrics")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.joins))
+
+	alice.say(t, "hello")
+	bob.expect(t, "alice: hello")
+	alice.say(t, "/who")
+	alice.expect(t, "*** 2 in the room: alice, bob")
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.messages), "commands aren't messages")
+	assert.Equal(t, 5.0, testutil.ToFloat64(m.bytes))
+	assert.NotZero(t, fanOuts(t, reg))
+
+	// connections turned away on every transport are counted
+	dialRoomLines(t, addr, "unknown", "carol").expect(t, "*** rejected: room \"unknown\" does not exist")
+	_, err = joinStream(t, chat, &butlerpb.ChatJoin{RoomId: ref.Id, Name: "alice"}).Recv()
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.rejected.WithLabelValues("NotFound")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.rejected.WithLabelValues("AlreadyExists")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues("Chat", "Join", "AlreadyExists")))
+
+	bob.conn.Close()
+	alice.expect(t, "bob left")
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.leaves))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.clients.WithLabelValues("metrics")))
+
+	// closed rooms are dropped
+	alice.conn.Close()
+	assert.Eventually(t, func() bool { return testutil.ToFloat64(m.rooms) == 0 }, 3*time.Second, 10*time.Millisecond)
+	assert.Zero(t, testutil.CollectAndCount(m.clients))
+}
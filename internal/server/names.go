@@ -0,0 +1,91 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NamePolicy describes which names the server accepts for rooms or users.
+// Zero fields fall back to the defaults of the kind of name being checked.
+type NamePolicy struct {
+	// MinLength and MaxLength limit the name length in runes.
+	MinLength, MaxLength int
+	// Pattern must match the whole name, a match of part of it isn't
+	// enough. Patterns with alternatives should be anchored with ^ and $.
+	Pattern *regexp.Regexp
+	// Reserved names can't be used, they are compared case-insensitively.
+	Reserved []string
+}
+
+// defaultRoomNamePolicy allows letters, digits, spaces and a few punctuation
+// characters.
+var defaultRoomNamePolicy = NamePolicy{
+	MinLength: 1,
+	MaxLength: 32,
+	Pattern:   regexp.MustCompile(`^[\p{L}\p{N} _.\-]+$`),
+}
+
+// defaultNicknamePolicy is the same as defaultRoomNamePolicy without spaces
+// and with the length the client allows.
+var defaultNicknamePolicy = NamePolicy{
+	MinLength: 1,
+	MaxLength: 20,
+	Pattern:   regexp.MustCompile(`^[\p{L}\p{N}_.\-]+$`),
+}
+
+func (p NamePolicy) withDefaults(defaults NamePolicy) NamePolicy {
+	if p.MinLength <= 0 {
+		p.MinLength = defaults.MinLength
+	}
+	if p.MaxLength <= 0 {
+		p.MaxLength = defaults.MaxLength
+	}
+	if p.Pattern == nil {
+		p.Pattern = defaults.Pattern
+	}
+	if p.Reserved == nil {
+		p.Reserved = defaults.Reserved
+	}
+	return p
+}
+
+// check returns the reason name violates the policy, if it does.
+func (p NamePolicy) check(name string) error {
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("must be valid UTF-8")
+	}
+	if length := utf8.RuneCountInString(name); length < p.MinLength || length > p.MaxLength {
+		return fmt.Errorf("must be %d to %d characters long", p.MinLength, p.MaxLength)
+	}
+	if strings.TrimFunc(name, unicode.IsSpace) != name {
+		return fmt.Errorf("must not start or end with whitespace")
+	}
+	if loc := p.Pattern.FindStringIndex(name); loc == nil || loc[0] != 0 || loc[1] != len(name) {
+		return fmt.Errorf("must match %s", p.Pattern)
+	}
+	for _, reserved := range p.Reserved {
+		if strings.EqualFold(name, reserved) {
+			return fmt.Errorf("\"%s\" is reserved", name)
+		}
+	}
+	return nil
+}
+
+// validateRoomName checks name against the room name policy p.
+func (p NamePolicy) validateRoomName(name string) error {
+	if err := p.withDefaults(defaultRoomNamePolicy).check(name); err != nil {
+		return errInvalidArgument("name", "room name "+err.Error())
+	}
+	return nil
+}
+
+// validateNickname checks name against the nickname policy p.
+func (p NamePolicy) validateNickname(name string) error {
+	if err := p.withDefaults(defaultNicknamePolicy).check(name); err != nil {
+		return errInvalidArgument("name", "user name "+err.Error())
+	}
+	return nil
+}
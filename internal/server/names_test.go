@@ -0,0 +1,69 @@
+package server
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNamePolicy_ValidateRoomName(t *testing.T) {
+	defaultPolicy := NamePolicy{}
+	strictPolicy := NamePolicy{
+		MinLength: 3,
+		MaxLength: 8,
+		Pattern:   regexp.MustCompile(`^[a-z]+$`),
+		Reserved:  []string{"admin", "lobby"},
+	}
+	unanchoredPolicy := NamePolicy{Pattern: regexp.MustCompile(`[a-z]+`)}
+
+	testCases := []struct {
+		policy NamePolicy
+		name   string
+		valid  bool
+	}{
+		{defaultPolicy, "general", true},
+		{defaultPolicy, "Команда 1", true},
+		{defaultPolicy, "team_a.b-c", true},
+		{defaultPolicy, "", false},
+		{defaultPolicy, "   ", false},
+		{defaultPolicy, " padded", false},
+		{defaultPolicy, "padded\t", false},
+		{defaultPolicy, "new\nline", false},
+		{defaultPolicy, "semi;colon", false},
+		{defaultPolicy, strings.Repeat("я", defaultRoomNamePolicy.MaxLength), true},
+		{defaultPolicy, strings.Repeat("я", defaultRoomNamePolicy.MaxLength+1), false},
+		{defaultPolicy, "\xff", false},
+		{strictPolicy, "chat", true},
+		{strictPolicy, "ab", false},
+		{strictPolicy, "abcdefghi", false},
+		{strictPolicy, "Chat", false},
+		{strictPolicy, "admin", false},
+		{strictPolicy, "LOBBY", false},
+		{unanchoredPolicy, "evil", true},
+		{unanchoredPolicy, "evil name!!", false},
+		{unanchoredPolicy, "!!evil", false},
+	}
+
+	for _, tc := range testCases {
+		err := tc.policy.validateRoomName(tc.name)
+		if tc.valid {
+			assert.NoError(t, err, "name %q", tc.name)
+		} else {
+			assert.Equal(t, codes.InvalidArgument, status.Code(err), "name %q", tc.name)
+		}
+	}
+}
+
+func TestNamePolicy_ValidateNickname(t *testing.T) {
+	policy := NamePolicy{}
+	for _, name := range []string{"alice", "bob_2", "Jörg", "x"} {
+		assert.NoError(t, policy.validateNickname(name), "name %q", name)
+	}
+	for _, name := range []string{"", "two words", " alice", "a:b", strings.Repeat("a", 21)} {
+		assert.Equal(t, codes.InvalidArgument, status.Code(policy.validateNickname(name)), "name %q", name)
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import "sync"
+
+// defaultQueueSize is the number of messages a client may fall behind when
+// RoomConfig.QueueSize isn't set.
+const defaultQueueSize = 256
+
+// OverflowPolicy tells what happens when a client falls so far behind that
+// its queue of outgoing messages is full.
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest discards the oldest queued message to make room
+	// for the new one. Framed clients notice the gap in sequence numbers.
+	OverflowDropOldest OverflowPolicy = iota
+	// OverflowDisconnect makes the client leave the room, telling it why.
+	OverflowDisconnect
+)
+
+// outbox is a client's bounded queue of outgoing messages. It is filled by
+// roomMonitor, which must never wait for a client, and drained by the
+// client's messageWriter.
+type outbox struct {
+	mu     sync.Mutex
+	queue  []message
+	limit  int
+	policy OverflowPolicy
+	// wake is signaled when a message is queued or the outbox is closed.
+	wake    chan struct{}
+	closed  bool
+	evicted bool
+}
+
+func newOutbox(limit int, policy OverflowPolicy) *outbox {
+	if limit <= 0 {
+		limit = defaultQueueSize
+	}
+	return &outbox{limit: limit, policy: policy, wake: make(chan struct{}, 1)}
+}
+
+// push queues msg without blocking. It reports false if the queue is full and
+// the client has to be evicted. Messages pushed after evict or close are
+// discarded.
+func (o *outbox) push(msg message) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed || o.evicted {
+		return true
+	}
+	if len(o.queue) >= o.limit {
+		if o.policy == OverflowDisconnect {
+			return false
+		}
+		o.queue = o.queue[1:]
+	}
+	o.queue = append(o.queue, msg)
+	o.signal()
+	return true
+}
+
+// evict discards the queued messages but the errors, so the client still
+// learns why its last requests failed, and makes last the final message
+// delivered.
+func (o *outbox) evict(last message) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var kept []message
+	for _, msg := range o.queue {
+		if msg.kind == errorMessage {
+			kept = append(kept, msg)
+		}
+	}
+	o.queue = append(kept, last)
+	o.evicted = true
+	o.signal()
+}
+
+// close makes pop report the end of the queue once the queued messages have
+// been taken.
+func (o *outbox) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.closed = true
+	o.signal()
+}
+
+// pop waits for the next message. It returns false once the outbox is closed
+// and empty. pop must only be called by a single goroutine.
+func (o *outbox) pop() (message, bool) {
+	for {
+		o.mu.Lock()
+		if len(o.queue) > 0 {
+			msg := o.queue[0]
+			o.queue = o.queue[1:]
+			o.mu.Unlock()
+			return msg, true
+		}
+		closed := o.closed
+		o.mu.Unlock()
+		if closed {
+			return message{}, false
+		}
+		<-o.wake
+	}
+}
+
+func (o *outbox) signal() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+
+	"github.com/dimaglushkov/go-chat/api/butlerpb"
+	"github.com/dimaglushkov/go-chat/internal/wire"
+)
+
+func popTexts(o *outbox) []string {
+	var texts []string
+	for {
+		msg, ok := o.pop()
+		if !ok {
+			return texts
+		}
+		texts = append(texts, msg.text)
+	}
+}
+
+func TestOutbox_DropOldest(t *testing.T) {
+	o := newOutbox(3, OverflowDropOldest)
+	for i := 1; i <= 5; i++ {
+		assert.True(t, o.push(message{text: strconv.Itoa(i)}))
+	}
+	o.close()
+	assert.True(t, o.push(message{text: "after close"}))
+
+	assert.Equal(t, []string{"3", "4", "5"}, popTexts(o), "the oldest messages are dropped")
+}
+
+func TestOutbox_Disconnect(t *testing.T) {
+	o := newOutbox(3, OverflowDisconnect)
+	for i := 1; i <= 2; i++ {
+		assert.True(t, o.push(message{text: strconv.Itoa(i)}))
+	}
+	assert.True(t, o.push(message{kind: errorMessage, text: "rejected"}))
+	assert.False(t, o.push(message{text: "4"}))
+
+	o.evict(message{text: "bye"})
+	assert.True(t, o.push(message{text: "after evict"}))
+	o.close()
+	assert.Equal(t, []string{"rejected", "bye"}, popTexts(o), "queued errors are kept")
+}
+
+func TestOutbox_PopWaits(t *testing.T) {
+	o := newOutbox(0, OverflowDropOldest)
+	assert.Equal(t, defaultQueueSize, o.limit)
+
+	popped := make(chan []string)
+	go func() { popped <- popTexts(o) }()
+	o.push(message{text: "1"})
+	o.push(message{text: "2"})
+	o.close()
+	select {
+	case texts := <-popped:
+		assert.Equal(t, []string{"1", "2"}, texts)
+	case <-time.After(3 * time.Second):
+		t.Fatal("pop did not return after close")
+	}
+}
+
+// joinStalledClient joins the room over a pipe nobody reads from until the
+// returned client is used, so the room can't write to it.
+func joinStalledClient(t testing.TB, b *Butler, ref *butlerpb.RoomRef, name string) *testClient {
+	r, ok := b.findRoomByID(ref.Id)
+	require.True(t, ok)
+	members := r.GetMembers()
+	conn, roomConn := net.Pipe()
+	t.Cleanup(func() { conn.Close() })
+	go r.handleConn(roomConn, roomConn, &wire.Frame{Type: wire.TypeHello, Name: name})
+	require.Eventually(t, func() bool { return r.GetMembers() > members }, 3*time.Second, 10*time.Millisecond)
+	return &testClient{conn: conn, r: wire.NewReader(conn)}
+}
+
+func TestRoom_StalledReader(t *testing.T) {
+	butler := NewButler(Config{Room: RoomConfig{QueueSize: 8}})
+	addr := serveRooms(t, &butler)
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "stalled", Size: 5})
+	require.NoError(t, err)
+
+	alice := joinTestClient(t, addr, ref, "alice")
+	bob := joinTestClient(t, addr, ref, "bob")
+	alice.expect(t, "bob joined")
+	slow := joinStalledClient(t, &butler, ref, "slow")
+	alice.expect(t, "slow joined")
+	bob.expect(t, "slow joined")
+
+	// the room keeps going while slow isn't reading
+	for i := 0; i < 50; i++ {
+		alice.say(t, fmt.Sprintf("message %d", i))
+		bob.expect(t, fmt.Sprintf("alice: message %d", i))
+	}
+
+	// slow gets the frame that was being written and the newest ones
+	assert.Equal(t, wire.TypePresence, slow.next(t).Type)
+	for i := 42; i < 50; i++ {
+		slow.expect(t, fmt.Sprintf("alice: message %d", i))
+	}
+	slow.say(t, "sorry, where were we?")
+	bob.expect(t, "slow: sorry, where were we?")
+}
+
+func TestRoom_SlowClientDisconnected(t *testing.T) {
+	butler := NewButler(Config{Room: RoomConfig{QueueSize: 4, Overflow: OverflowDisconnect}})
+	addr := serveRooms(t, &butler)
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "strict", Size: 5})
+	require.NoError(t, err)
+
+	alice := joinTestClient(t, addr, ref, "alice")
+	slow := joinStalledClient(t, &butler, ref, "slow")
+	alice.expect(t, "slow joined")
+
+	for i := 0; i < 5; i++ {
+		alice.say(t, fmt.Sprintf("message %d", i))
+	}
+	alice.expect(t, "slow left")
+
+	assert.Equal(t, wire.TypePresence, slow.next(t).Type)
+	reply := slow.next(t)
+	assert.Equal(t, wire.TypeError, reply.Type)
+	assert.Equal(t, codes.ResourceExhausted.String(), reply.Code)
+	slow.expectClosed(t)
+}
+
+func TestRoom_WriteTimeout(t *testing.T) {
+	butler := NewButler(Config{Room: RoomConfig{WriteTimeout: 100 * time.Millisecond}})
+	addr := serveRooms(t, &butler)
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "impatient", Size: 5})
+	require.NoError(t, err)
+
+	alice := joinTestClient(t, addr, ref, "alice")
+	joinStalledClient(t, &butler, ref, "slow")
+	alice.expect(t, "slow joined")
+	alice.expect(t, "slow left")
+
+	// the deadline of the last message doesn't outlive it
+	time.Sleep(300 * time.Millisecond)
+	alice.send(t, wire.Frame{Type: wire.TypeHello, Version: wire.Version})
+	alice.expect(t, "*** rejected: invalid frame: unexpected hello frame")
+}
+
+// benchmarkBroadcast measures how fast messages sent by one client reach
+// another one, with stalled clients in the room that never read.
+func benchmarkBroadcast(b *testing.B, stalled int) {
+	// bob's queue must not overflow when alice gets ahead of him
+	butler := NewButler(Config{Room: RoomConfig{QueueSize: b.N + 16}})
+	addr := serveRooms(b, &butler)
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "bench", Size: int32(2 + stalled)})
+	require.NoError(b, err)
+
+	alice := joinTestClient(b, addr, ref, "alice")
+	bob := joinTestClient(b, addr, ref, "bob")
+	alice.next(b)
+	for i := 0; i < stalled; i++ {
+		joinStalledClient(b, &butler, ref, "slow"+strconv.Itoa(i))
+		bob.next(b)
+	}
+
+	b.ResetTimer()
+	go func() {
+		for i := 0; i < b.N; i++ {
+			wire.Write(alice.conn, &wire.Frame{Type: wire.TypeChat, Text: "hi"})
+		}
+	}()
+	for i := 0; i < b.N; i++ {
+		bob.next(b)
+	}
+}
+
+func BenchmarkRoom_Broadcast(b *testing.B) {
+	for _, stalled := range []int{0, 1, 8} {
+		b.Run(fmt.Sprintf("stalled=%d", stalled), func(b *testing.B) {
+			benchmarkBroadcast(b, stalled)
+		})
+	}
+}
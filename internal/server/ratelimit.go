@@ -0,0 +1,320 @@
+package server
+
+import (
+	"log"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dimaglushkov/go-chat/api/butlerpb"
+)
+
+// strikeWindow is how long a rejected message counts towards
+// RateLimits.Strikes.
+const strikeWindow = time.Minute
+
+// RateLimit allows Burst events at once and Rate events per second on average
+// after that. The zero value allows everything.
+type RateLimit struct {
+	Rate float64
+	// Burst defaults to Rate rounded up, and to at least one.
+	Burst int
+}
+
+func (l RateLimit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return math.Max(1, math.Ceil(l.Rate))
+}
+
+// stricter returns the stricter of l and o, either of which may be unset.
+func (l RateLimit) stricter(o RateLimit) RateLimit {
+	if o.Rate <= 0 {
+		return l
+	}
+	if l.Rate <= 0 {
+		return o
+	}
+	return RateLimit{Rate: math.Min(l.Rate, o.Rate), Burst: int(math.Min(l.burst(), o.burst()))}
+}
+
+// RateLimits are the limits on what the clients of a room may send. Lines are
+// counted whether they are messages or commands.
+type RateLimits struct {
+	// Messages and Bytes limit the lines of every client.
+	Messages RateLimit
+	Bytes    RateLimit
+	// IPMessages, IPBytes and IPJoins are shared by the clients connecting
+	// from the same IP address to any room of the server, every room
+	// applying its own limits to what they send.
+	IPMessages RateLimit
+	IPBytes    RateLimit
+	IPJoins    RateLimit
+	// Strikes is the number of lines a client may have rejected for going
+	// over the limits, or for not being lines at all, within a minute before
+	// it is punished. Zero never punishes clients.
+	Strikes int
+	// MuteFor is how long punished clients can't send anything to the room.
+	// Zero disconnects them instead.
+	MuteFor time.Duration
+}
+
+// stricter returns the limits of l made stricter by the ones set in o. The
+// punishment set in o is used if it has any strikes.
+func (l RateLimits) stricter(o RateLimits) RateLimits {
+	l.Messages = l.Messages.stricter(o.Messages)
+	l.Bytes = l.Bytes.stricter(o.Bytes)
+	l.IPMessages = l.IPMessages.stricter(o.IPMessages)
+	l.IPBytes = l.IPBytes.stricter(o.IPBytes)
+	l.IPJoins = l.IPJoins.stricter(o.IPJoins)
+	if o.Strikes > 0 && (l.Strikes <= 0 || o.Strikes <= l.Strikes) {
+		l.Strikes, l.MuteFor = o.Strikes, o.MuteFor
+	}
+	return l
+}
+
+// rateLimitsFromProto returns the limits a room is asked to be created with.
+func rateLimitsFromProto(pb *butlerpb.RateLimits) (RateLimits, error) {
+	var l RateLimits
+	if pb == nil {
+		return l, nil
+	}
+	for _, field := range []struct {
+		name string
+		pb   *butlerpb.RateLimit
+		l    *RateLimit
+	}{
+		{"limits.messages", pb.Messages, &l.Messages},
+		{"limits.bytes", pb.Bytes, &l.Bytes},
+		{"limits.ip_messages", pb.IpMessages, &l.IPMessages},
+		{"limits.ip_bytes", pb.IpBytes, &l.IPBytes},
+		{"limits.ip_joins", pb.IpJoins, &l.IPJoins},
+	} {
+		if field.pb.GetRate() < 0 || field.pb.GetBurst() < 0 || math.IsNaN(field.pb.GetRate()) {
+			return l, errInvalidArgument(field.name, "rate and burst must not be negative")
+		}
+		*field.l = RateLimit{Rate: field.pb.GetRate(), Burst: int(field.pb.GetBurst())}
+	}
+	if pb.Strikes < 0 {
+		return l, errInvalidArgument("limits.strikes", "strikes must not be negative")
+	}
+	l.Strikes = int(pb.Strikes)
+	if pb.MuteFor != nil {
+		if err := pb.MuteFor.CheckValid(); err != nil || pb.MuteFor.AsDuration() < 0 {
+			return l, errInvalidArgument("limits.mute_for", "mute duration must not be negative")
+		}
+		l.MuteFor = pb.MuteFor.AsDuration()
+	}
+	return l, nil
+}
+
+// tokenBucket enforces a RateLimit. The limit is passed to every call so that
+// the zero value is ready to use.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) refill(l RateLimit, now time.Time) {
+	if b.last.IsZero() {
+		b.tokens = l.burst()
+	} else if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(l.burst(), b.tokens+elapsed*l.Rate)
+	}
+	b.last = now
+}
+
+// allows reports whether n events may happen at now. Events larger than the
+// burst are let through once the bucket is full, taking it into debt.
+func (b *tokenBucket) allows(l RateLimit, n float64, now time.Time) bool {
+	if l.Rate <= 0 {
+		return true
+	}
+	b.refill(l, now)
+	return b.tokens >= math.Min(n, l.burst())
+}
+
+// take records n events, allows must have been called first.
+func (b *tokenBucket) take(l RateLimit, n float64) {
+	if l.Rate > 0 {
+		b.tokens -= n
+	}
+}
+
+// full reports whether the bucket has refilled completely, so it can be
+// forgotten.
+func (b *tokenBucket) full(l RateLimit, now time.Time) bool {
+	if l.Rate <= 0 || b.last.IsZero() {
+		return true
+	}
+	b.refill(l, now)
+	return b.tokens >= l.burst()
+}
+
+// clientFlood is the rate limiting state of a client. It must only be used by
+// roomMonitor.
+type clientFlood struct {
+	messages, bytes tokenBucket
+	strikes         int
+	firstStrike     time.Time
+	mutedUntil      time.Time
+	ip              *ipFlood
+}
+
+// ipFlood is the rate limiting state shared by the clients connecting from
+// the same IP address. It must only be used with the lock of its ipStore held.
+type ipFlood struct {
+	messages, bytes, joins tokenBucket
+	clients                int
+	// limits are the ones last applied to the buckets, by whichever room
+	// the address used last.
+	limits RateLimits
+}
+
+// ipStore holds the ipFlood of every address with clients, or which can't
+// join or send again right away. A Butler shares one between its rooms.
+type ipStore struct {
+	mu  sync.Mutex
+	ips map[string]*ipFlood
+}
+
+func newIPStore() *ipStore {
+	return &ipStore{ips: make(map[string]*ipFlood)}
+}
+
+// hostOf returns the IP address of a member's remote address.
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// join counts a client joining a room with limits from host against the
+// limits of the address.
+func (s *ipStore) join(host string, limits RateLimits, now time.Time) (*ipFlood, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ip, ok := s.ips[host]
+	if !ok {
+		ip = &ipFlood{}
+		s.ips[host] = ip
+	}
+	ip.limits = limits
+	if !ip.joins.allows(limits.IPJoins, 1, now) {
+		return nil, errRateLimited("address", "joins")
+	}
+	ip.joins.take(limits.IPJoins, 1)
+	ip.clients++
+	return ip, nil
+}
+
+// post counts a line of size bytes sent to a room with limits against the
+// limits of the address ip, unless it goes over them.
+func (s *ipStore) post(ip *ipFlood, limits RateLimits, size float64, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ip.limits = limits
+	switch {
+	case !ip.messages.allows(limits.IPMessages, 1, now):
+		return errRateLimited("address", "messages")
+	case !ip.bytes.allows(limits.IPBytes, size, now):
+		return errRateLimited("address", "bytes")
+	}
+	ip.messages.take(limits.IPMessages, 1)
+	ip.bytes.take(limits.IPBytes, size)
+	return nil
+}
+
+// leave drops a client of ip, and the state of the addresses that have no
+// clients left and could join again right away.
+func (s *ipStore) leave(ip *ipFlood) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ip.clients--
+	for host, other := range s.ips {
+		limits := other.limits
+		if other.clients == 0 && other.joins.full(limits.IPJoins, now) &&
+			other.messages.full(limits.IPMessages, now) && other.bytes.full(limits.IPBytes, now) {
+			delete(s.ips, host)
+		}
+	}
+}
+
+// admitJoin counts a client joining the room against the limits of its IP
+// address. It must only be called by roomMonitor.
+func (r *room) admitJoin(cl *client) error {
+	ip, err := r.ips.join(hostOf(cl.addr), r.cfg.Limits, time.Now())
+	if err != nil {
+		return err
+	}
+	cl.flood.ip = ip
+	return nil
+}
+
+// forgetFlood drops the state of a client that has left the room. It must
+// only be called by roomMonitor.
+func (r *room) forgetFlood(cl *client) {
+	if cl.flood.ip != nil {
+		r.ips.leave(cl.flood.ip)
+		cl.flood.ip = nil
+	}
+}
+
+// admitPost reports whether p is within the room's rate limits, counting its
+// raw size before the text is checked. If it isn't, the client is told so and
+// punished if it keeps trying. It must only be called by roomMonitor.
+func (r *room) admitPost(p post) bool {
+	now := time.Now()
+	cl, limits := p.from, r.cfg.Limits
+	flood := &cl.flood
+	if now.Before(flood.mutedUntil) {
+		r.deliver(cl, rejectionOf(p, errMuted(flood.mutedUntil.Sub(now))))
+		return false
+	}
+
+	size := float64(len(p.text))
+	var err error
+	switch {
+	case !flood.messages.allows(limits.Messages, 1, now):
+		err = errRateLimited("client", "messages")
+	case !flood.bytes.allows(limits.Bytes, size, now):
+		err = errRateLimited("client", "bytes")
+	case flood.ip != nil:
+		err = r.ips.post(flood.ip, limits, size, now)
+	}
+	if err == nil {
+		flood.messages.take(limits.Messages, 1)
+		flood.bytes.take(limits.Bytes, size)
+		return true
+	}
+	r.strike(p, err)
+	return false
+}
+
+// strike rejects p for err and punishes its client if it has had too many
+// lines rejected lately. It must only be called by roomMonitor.
+func (r *room) strike(p post, err error) {
+	now := time.Now()
+	cl, limits := p.from, r.cfg.Limits
+	flood := &cl.flood
+	if now.Sub(flood.firstStrike) > strikeWindow {
+		flood.strikes, flood.firstStrike = 0, now
+	}
+	flood.strikes++
+	switch {
+	case limits.Strikes <= 0 || flood.strikes < limits.Strikes:
+		r.deliver(cl, rejectionOf(p, err))
+	case limits.MuteFor > 0:
+		log.Printf("muting %s (%s) in room \"%s\" for %s: flooding", cl.name, cl.addr, r.name, limits.MuteFor)
+		flood.strikes = 0
+		flood.mutedUntil = now.Add(limits.MuteFor)
+		r.deliver(cl, rejectionOf(p, errMuted(limits.MuteFor)))
+	default:
+		log.Printf("disconnecting %s (%s) from room \"%s\": flooding", cl.name, cl.addr, r.name)
+		r.kick(cl, errFlooding())
+	}
+}
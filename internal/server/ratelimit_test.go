@@ -0,0 +1,255 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/dimaglushkov/go-chat/api/butlerpb"
+	"github.com/dimaglushkov/go-chat/internal/wire"
+)
+
+func TestTokenBucket(t *testing.T) {
+	limit := RateLimit{Rate: 2, Burst: 3}
+	start := time.Now()
+	var b tokenBucket
+	allow := func(n float64, at time.Duration) bool {
+		if !b.allows(limit, n, start.Add(at)) {
+			return false
+		}
+		b.take(limit, n)
+		return true
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, allow(1, 0), "burst %d", i)
+	}
+	assert.False(t, allow(1, 0))
+	assert.True(t, allow(1, 500*time.Millisecond))
+	assert.False(t, allow(1, 500*time.Millisecond))
+	assert.False(t, b.full(limit, start.Add(time.Second)))
+	assert.True(t, b.full(limit, start.Add(2*time.Second)))
+
+	// events larger than the burst get through a full bucket
+	assert.True(t, allow(10, 2*time.Second))
+	assert.False(t, allow(1, 4*time.Second))
+	assert.True(t, allow(1, 6*time.Second))
+
+	var unlimited tokenBucket
+	for i := 0; i < 100; i++ {
+		assert.True(t, unlimited.allows(RateLimit{}, 1000, start))
+	}
+}
+
+func TestRateLimits_Stricter(t *testing.T) {
+	server := RateLimits{Messages: RateLimit{Rate: 5, Burst: 10}, Bytes: RateLimit{Rate: 1000}, Strikes: 5, MuteFor: time.Minute}
+	room := RateLimits{Messages: RateLimit{Rate: 10, Burst: 2}, IPJoins: RateLimit{Rate: 1}, Strikes: 10}
+
+	assert.Equal(t, RateLimits{
+		Messages: RateLimit{Rate: 5, Burst: 2},
+		Bytes:    RateLimit{Rate: 1000},
+		IPJoins:  RateLimit{Rate: 1},
+		Strikes:  5,
+		MuteFor:  time.Minute,
+	}, server.stricter(room))
+
+	room.Strikes = 2
+	assert.Equal(t, 2, server.stricter(room).Strikes)
+	assert.Equal(t, time.Duration(0), server.stricter(room).MuteFor)
+	assert.Equal(t, server, server.stricter(RateLimits{}))
+}
+
+// floodRoom creates a room with limits and joins it as alice.
+func floodRoom(t *testing.T, limits RateLimits) (*testClient, *Butler, *butlerpb.RoomRef, string) {
+	butler := NewButler(Config{Room: RoomConfig{Limits: limits}})
+	addr := serveRooms(t, &butler)
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "flooded", Size: 5})
+	require.NoError(t, err)
+	return joinTestClient(t, addr, ref, "alice"), &butler, ref, addr
+}
+
+func (c *testClient) expectRateLimited(t *testing.T, ref, text string) {
+	f := c.next(t)
+	assert.Equal(t, wire.TypeError, f.Type)
+	assert.Equal(t, codes.ResourceExhausted.String(), f.Code)
+	assert.Equal(t, ref, f.Ref)
+	assert.Contains(t, f.Text, text)
+}
+
+func TestRoom_RateLimit(t *testing.T) {
+	alice, _, ref, addr := floodRoom(t, RateLimits{Messages: RateLimit{Rate: 0.001, Burst: 2}})
+	bob := joinTestClient(t, addr, ref, "bob")
+	alice.expect(t, "bob joined")
+
+	for i := 1; i <= 4; i++ {
+		alice.send(t, wire.Frame{Type: wire.TypeChat, Text: fmt.Sprintf("flood %d", i), Ref: fmt.Sprint(i)})
+	}
+	assert.Equal(t, wire.TypeAck, alice.next(t).Type)
+	assert.Equal(t, wire.TypeAck, alice.next(t).Type)
+	alice.expectRateLimited(t, "3", "too many messages")
+	alice.expectRateLimited(t, "4", "too many messages")
+	bob.expect(t, "alice: flood 1")
+	bob.expect(t, "alice: flood 2")
+
+	// bob has a bucket of his own
+	bob.say(t, "calm")
+	alice.expect(t, "bob: calm")
+}
+
+func TestRoom_RateLimitBytes(t *testing.T) {
+	alice, _, _, _ := floodRoom(t, RateLimits{Bytes: RateLimit{Rate: 0.001, Burst: 10}})
+
+	alice.send(t, wire.Frame{Type: wire.TypeChat, Text: "this line is longer than ten bytes", Ref: "1"})
+	assert.Equal(t, wire.TypeAck, alice.next(t).Type)
+	alice.send(t, wire.Frame{Type: wire.TypeChat, Text: "hi", Ref: "2"})
+	alice.expectRateLimited(t, "2", "too many bytes")
+}
+
+func TestRoom_RateLimitMute(t *testing.T) {
+	alice, _, _, _ := floodRoom(t, RateLimits{Messages: RateLimit{Rate: 0.001, Burst: 1}, Strikes: 2, MuteFor: time.Hour})
+
+	for i := 1; i <= 4; i++ {
+		alice.send(t, wire.Frame{Type: wire.TypeChat, Text: "flood", Ref: fmt.Sprint(i)})
+	}
+	assert.Equal(t, wire.TypeAck, alice.next(t).Type)
+	alice.expectRateLimited(t, "2", "too many messages")
+	alice.expectRateLimited(t, "3", "muted for flooding the room, wait 1h0m0s")
+	alice.expectRateLimited(t, "4", "muted for flooding the room")
+}
+
+func TestRoom_RateLimitDisconnect(t *testing.T) {
+	alice, _, _, _ := floodRoom(t, RateLimits{Messages: RateLimit{Rate: 0.001, Burst: 1}, Strikes: 2})
+
+	for i := 1; i <= 3; i++ {
+		alice.say(t, "flood")
+	}
+	alice.expectRateLimited(t, "", "too many messages")
+	alice.expectRateLimited(t, "", "disconnected for flooding")
+	alice.expectClosed(t)
+}
+
+func TestRoom_RateLimitOversize(t *testing.T) {
+	butler := NewButler(Config{Room: RoomConfig{MaxMessageSize: 16, Limits: RateLimits{
+		Messages: RateLimit{Rate: 0.001, Burst: 4},
+		Strikes:  2,
+	}}})
+	addr := serveRooms(t, &butler)
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "flooded", Size: 5})
+	require.NoError(t, err)
+	alice := joinTestClient(t, addr, ref, "alice")
+
+	// oversize lines are rejected without punishing the client, but count
+	// as messages
+	junk := strings.Repeat("a", 17)
+	for i := 1; i <= 3; i++ {
+		alice.send(t, wire.Frame{Type: wire.TypeChat, Text: junk, Ref: fmt.Sprint(i)})
+		reply := alice.next(t)
+		assert.Equal(t, codes.InvalidArgument.String(), reply.Code)
+		assert.Equal(t, fmt.Sprint(i), reply.Ref)
+	}
+	alice.send(t, wire.Frame{Type: wire.TypeChat, Text: "still here", Ref: "4"})
+	assert.Equal(t, wire.TypeAck, alice.next(t).Type)
+	alice.send(t, wire.Frame{Type: wire.TypeChat, Text: junk, Ref: "5"})
+	alice.expectRateLimited(t, "5", "too many messages")
+
+	// oversize lines use up the byte budget too
+	butler = NewButler(Config{Room: RoomConfig{MaxMessageSize: 16, Limits: RateLimits{Bytes: RateLimit{Rate: 0.001, Burst: 20}}}})
+	addr = serveRooms(t, &butler)
+	ref, err = butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "flooded", Size: 5})
+	require.NoError(t, err)
+	bob := joinTestClient(t, addr, ref, "bob")
+	bob.send(t, wire.Frame{Type: wire.TypeChat, Text: junk, Ref: "1"})
+	assert.Equal(t, codes.InvalidArgument.String(), bob.next(t).Code)
+	bob.send(t, wire.Frame{Type: wire.TypeChat, Text: "hello", Ref: "2"})
+	bob.expectRateLimited(t, "2", "too many bytes")
+}
+
+func TestRoom_RateLimitInvalidFrames(t *testing.T) {
+	alice, _, _, _ := floodRoom(t, RateLimits{Messages: RateLimit{Rate: 0.001, Burst: 3}, Strikes: 2})
+
+	for i := 0; i < 2; i++ {
+		_, err := alice.conn.Write([]byte("{\"type\":\"chat\"\n"))
+		require.NoError(t, err)
+	}
+	reply := alice.next(t)
+	assert.Equal(t, codes.InvalidArgument.String(), reply.Code)
+	alice.expectRateLimited(t, "", "disconnected for flooding")
+	alice.expectClosed(t)
+}
+
+func TestRoom_RateLimitIP(t *testing.T) {
+	alice, butler, ref, addr := floodRoom(t, RateLimits{
+		IPMessages: RateLimit{Rate: 0.001, Burst: 2},
+		IPJoins:    RateLimit{Rate: 0.001, Burst: 2},
+	})
+	bob := joinTestClient(t, addr, ref, "bob")
+	alice.expect(t, "bob joined")
+
+	// every client connects from localhost
+	carol := dialRoom(t, addr, wire.Frame{Room: ref.Id, Name: "carol"})
+	assert.Equal(t, wire.TypeHello, carol.next(t).Type)
+	carol.expectRateLimited(t, "", "too many joins")
+
+	alice.say(t, "one")
+	bob.expect(t, "alice: one")
+	bob.say(t, "two")
+	alice.expect(t, "bob: two")
+	alice.send(t, wire.Frame{Type: wire.TypeChat, Text: "three", Ref: "3"})
+	alice.expectRateLimited(t, "3", "too many messages")
+
+	r, ok := butler.findRoomByID(ref.Id)
+	require.True(t, ok)
+	assert.Equal(t, 2, r.GetMembers())
+}
+
+func TestButler_RateLimitIPAcrossRooms(t *testing.T) {
+	alice, butler, ref, addr := floodRoom(t, RateLimits{
+		IPMessages: RateLimit{Rate: 0.001, Burst: 2},
+		IPJoins:    RateLimit{Rate: 0.001, Burst: 2},
+	})
+	other, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "other", Size: 5})
+	require.NoError(t, err)
+	bob := joinTestClient(t, addr, other, "bob")
+
+	// the address used up its joins in the first room and the second one
+	carol := dialRoom(t, addr, wire.Frame{Room: ref.Id, Name: "carol"})
+	assert.Equal(t, wire.TypeHello, carol.next(t).Type)
+	carol.expectRateLimited(t, "", "too many joins")
+
+	alice.send(t, wire.Frame{Type: wire.TypeChat, Text: "one", Ref: "1"})
+	assert.Equal(t, wire.TypeAck, alice.next(t).Type)
+	bob.send(t, wire.Frame{Type: wire.TypeChat, Text: "two", Ref: "2"})
+	assert.Equal(t, wire.TypeAck, bob.next(t).Type)
+	bob.send(t, wire.Frame{Type: wire.TypeChat, Text: "three", Ref: "3"})
+	bob.expectRateLimited(t, "3", "too many messages")
+}
+
+func TestButler_CreateRoomLimits(t *testing.T) {
+	butler := NewButler(Config{Room: RoomConfig{Limits: RateLimits{Messages: RateLimit{Rate: 1, Burst: 5}}}})
+	ctx := context.Background()
+
+	ref, err := butler.CreateRoom(ctx, &butlerpb.RoomNameSize{Name: "strict", Limits: &butlerpb.RateLimits{
+		Messages: &butlerpb.RateLimit{Rate: 10, Burst: 2},
+		Strikes:  3,
+		MuteFor:  durationpb.New(time.Minute),
+	}})
+	require.NoError(t, err)
+	r, ok := butler.findRoomByID(ref.Id)
+	require.True(t, ok)
+	assert.Equal(t, RateLimits{Messages: RateLimit{Rate: 1, Burst: 2}, Strikes: 3, MuteFor: time.Minute}, r.cfg.Limits)
+
+	_, err = butler.CreateRoom(ctx, &butlerpb.RoomNameSize{Name: "negative", Limits: &butlerpb.RateLimits{
+		IpBytes: &butlerpb.RateLimit{Rate: -1},
+	}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, ok = butler.findRoom("negative")
+	assert.False(t, ok)
+}
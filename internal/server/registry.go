@@ -0,0 +1,82 @@
+package server
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/dimaglushkov/go-chat/api/butlerpb"
+)
+
+// The registry of open rooms consists of b.rooms, b.roomsByID and
+// b.reserved, all guarded by b.mu. A name is reserved before its room gets
+// created and committed once the room is ready, so of any number of
+// concurrent creates with the same name exactly one succeeds.
+
+// reserveRoom takes name for a room that is about to be created. The
+// reservation must be either committed or released.
+func (b *Butler) reserveRoom(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closing {
+		return errShuttingDown()
+	}
+	if _, ok := b.rooms[name]; ok || b.reserved[name] {
+		return errRoomExists(name)
+	}
+	if len(b.rooms)+len(b.reserved) >= maxRooms {
+		return errResourceExhausted("rooms", fmt.Sprintf("server already has the maximum of %d rooms open", maxRooms))
+	}
+	b.reserved[name] = true
+	return nil
+}
+
+func (b *Butler) releaseRoom(name string) {
+	b.mu.Lock()
+	delete(b.reserved, name)
+	b.mu.Unlock()
+}
+
+// commitRoom turns the reservation of r's name into an open room. It fails
+// and releases the reservation if the Butler has started shutting down since
+// the name was reserved.
+func (b *Butler) commitRoom(r *room) error {
+	b.mu.Lock()
+	delete(b.reserved, r.name)
+	if b.closing {
+		b.mu.Unlock()
+		return errShuttingDown()
+	}
+	b.rooms[r.name] = r
+	b.roomsByID[r.id] = r
+	b.publish(butlerpb.RoomEvent_CREATED, r)
+	b.mu.Unlock()
+	b.metrics.roomOpened()
+	log.Printf("created room \"%s\" with id %s\n", r.name, r.id)
+	return nil
+}
+
+func (b *Butler) removeRoom(r *room) {
+	b.mu.Lock()
+	delete(b.rooms, r.name)
+	delete(b.roomsByID, r.id)
+	b.publish(butlerpb.RoomEvent_CLOSED, r)
+	// under the lock, a new room with the same name would lose its series
+	// otherwise
+	b.metrics.roomClosed(r.name)
+	b.mu.Unlock()
+}
+
+func (b *Butler) findRoom(name string) (*room, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	r, ok := b.rooms[name]
+	return r, ok
+}
+
+func (b *Butler) findRoomByID(id string) (*room, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	r, ok := b.roomsByID[id]
+	return r, ok
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/dimaglushkov/go-chat/api/butlerpb"
+)
+
+// TestButler_ConcurrentCreate is meant to be run with -race as well.
+func TestButler_ConcurrentCreate(t *testing.T) {
+	const creators = 50
+	butler := NewButler(Config{})
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	results := make(chan error, creators)
+	start := make(chan struct{})
+	for i := 0; i < creators; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := butler.CreateRoom(ctx, &butlerpb.RoomNameSize{Name: "contested", Size: 2})
+			results <- err
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(results)
+
+	created := 0
+	for err := range results {
+		if err == nil {
+			created++
+			continue
+		}
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	}
+	assert.Equal(t, 1, created)
+
+	list, err := butler.ListRooms(ctx, &butlerpb.ListRoomsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, list.Rooms, 1)
+	assert.Empty(t, butler.reserved)
+}
+
+func TestButler_ReservationRelease(t *testing.T) {
+	butler := NewButler(Config{})
+
+	require.NoError(t, butler.reserveRoom("pending"))
+	_, ok := butler.findRoom("pending")
+	assert.False(t, ok, "reserved rooms must not be visible before they are committed")
+	assert.Equal(t, codes.AlreadyExists, status.Code(butler.reserveRoom("pending")))
+
+	butler.releaseRoom("pending")
+	assert.NoError(t, butler.reserveRoom("pending"))
+}
@@ -1,146 +1,789 @@
 package server
 
 import (
-	"bufio"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/dimaglushkov/go-chat/api/butlerpb"
+	"github.com/dimaglushkov/go-chat/internal/wire"
+)
+
+type messageKind int
+
+const (
+	// chatMessage is a line a client has sent to the room, or a notice of
+	// the room to all of its clients if it has no sender.
+	chatMessage messageKind = iota
+	// systemMessage is a reply of the room to a single client, such as the
+	// result of a command.
+	systemMessage
+	// joinMessage and leaveMessage tell that sender has entered or left the
+	// room.
+	joinMessage
+	leaveMessage
+	// presenceMessage lists the names of the room's clients in members.
+	presenceMessage
+	// ackMessage acknowledges the client's post with the same ref.
+	ackMessage
+	// errorMessage tells a client why its request failed.
+	errorMessage
 )
 
 type message struct {
+	kind         messageKind
 	sender, text string
+	ref          string
+	code         codes.Code
+	members      []string
+	// replayed messages come from the room's history.
+	replayed bool
+	// id and seq are assigned by the room to the messages sent to all of
+	// its clients, see room.stamp.
+	id     string
+	seq    uint64
+	sentAt time.Time
+}
+
+// timestamp returns the time msg was sent at. Messages sent to a single
+// client aren't stamped, they are sent right away.
+func (msg message) timestamp() time.Time {
+	if msg.sentAt.IsZero() {
+		return time.Now().UTC()
+	}
+	return msg.sentAt
+}
+
+// systemPrefix marks system messages in the line protocol.
+const systemPrefix = "*** "
+
+// line renders msg for the line protocol. Messages that only make sense to
+// framed clients, such as acks, have no line.
+func (msg message) line() (string, bool) {
+	switch msg.kind {
+	case chatMessage:
+		if msg.sender != "" {
+			return msg.sender + ": " + msg.text, true
+		}
+		return msg.text, true
+	case systemMessage:
+		return systemPrefix + msg.text, true
+	case joinMessage:
+		return msg.sender + " joined", true
+	case leaveMessage:
+		return msg.sender + " left", true
+	case errorMessage:
+		return systemPrefix + "rejected: " + msg.text, true
+	}
+	return "", false
 }
 
-func (msg message) String() string {
-	if msg.sender != "" {
-		return msg.sender + ": " + msg.text
+// frame renders msg for the framed protocol.
+func (msg message) frame() *wire.Frame {
+	f := &wire.Frame{ID: msg.id, Seq: msg.seq, Time: msg.timestamp().UnixNano() / int64(time.Millisecond)}
+	switch msg.kind {
+	case chatMessage:
+		f.Type, f.Sender, f.Text, f.Replayed = wire.TypeChat, msg.sender, msg.text, msg.replayed
+	case systemMessage:
+		f.Type, f.Text = wire.TypeSystem, msg.text
+	case joinMessage:
+		f.Type, f.Name = wire.TypeJoin, msg.sender
+	case leaveMessage:
+		f.Type, f.Name = wire.TypeLeave, msg.sender
+	case presenceMessage:
+		f.Type, f.Members = wire.TypePresence, msg.members
+	case ackMessage:
+		f.Type, f.Ref = wire.TypeAck, msg.ref
+	case errorMessage:
+		f.Type, f.Code, f.Text, f.Ref = wire.TypeError, msg.code.String(), msg.text, msg.ref
 	}
-	return msg.text
+	return f
+}
+
+// post is a line of text a client has sent to the room. ref, if set, is
+// acknowledged once the room has handled the post.
+type post struct {
+	from *client
+	text string
+	ref  string
+	// tooLong is set instead of the text when the line was longer than
+	// the client's transport can read.
+	tooLong bool
+	// invalid is set instead of the text when the client sent something
+	// that isn't a line at all, such as a malformed frame. It is the error
+	// the client is answered with.
+	invalid error
 }
 
+// client is a member of the room. Clients are identified by their pointers,
+// names are for display only and can change.
 type client struct {
 	name, addr string
-	messages   chan message
-	done       chan struct{}
+	out        *outbox
+	member     member
+	// admitted receives the result of roomMonitor checking the client's
+	// name when it enters the room.
+	admitted chan error
+	flood    clientFlood
+	// loggedIn clients joined with a session token or a client certificate
+	// and keep the name they were given, guests joined without either on a
+	// server with accounts.
+	loggedIn, guest bool
+}
+
+// displayName returns the name cl is shown under in the room if it is called
+// name, guests get a marker after theirs.
+func (cl *client) displayName(name string) string {
+	if cl.guest {
+		return name + guestMarker
+	}
+	return name
+}
+
+// rejection tells a member why its request failed, e.g. why it could not join
+// the room.
+func rejection(err error) message {
+	st := status.Convert(err)
+	return message{kind: errorMessage, code: st.Code(), text: st.Message()}
+}
+
+// rejectionOf tells a member why its post was rejected.
+func rejectionOf(p post, err error) message {
+	msg := rejection(err)
+	msg.ref = p.ref
+	return msg
 }
 
 type room struct {
+	id        string
+	name      string
+	creator   string
+	createdAt time.Time
+	members   int32
+	// passwordHash is nil for public rooms.
+	passwordHash []byte
+	cfg          RoomConfig
+	// closeReason tells why the room was closed, it is set by roomMonitor
+	// right before it closes r.close.
+	closeReason string
+	// onChange, if set, is called by roomMonitor every time a client
+	// enters or leaves the room. It must not block.
+	onChange func()
+
 	sema     chan any
-	messages chan message
-	toEnter  chan client
-	toLeave  chan client
+	messages chan post
+	toEnter  chan *client
+	toLeave  chan *client
+	// toDrain receives the notice to send the clients before the room
+	// closes for the server shutting down, see drain.
+	toDrain chan string
 
-	listener net.Listener
-	clients  map[client]bool
-	close    chan any
+	commands commandSet
+	// accounts is nil unless the server has accounts.
+	accounts *accountStore
+	tickets  *ticketStore
+	// metrics is nil unless the server has metrics.
+	metrics *metrics
+	topic   string
+	clients map[*client]bool
+	// ips holds the rate limiting state of the addresses of the clients,
+	// it is shared with the other rooms of the Butler.
+	ips     *ipStore
+	history []message
+	// seq is the sequence number of the last message sent to the whole
+	// room.
+	seq uint64
+	// chatLog is nil unless the room keeps a log on disk.
+	chatLog *roomLog
+	close   chan any
+	// closed is closed once Open has written the room's last log record and
+	// closed its log.
+	closed chan any
+	// writers counts the messageWriters of the clients admitted to the
+	// room. roomMonitor adds to it, so it is final once close is closed.
+	writers sync.WaitGroup
 }
 
-func NewRoom(roomSize int) (r room, err error) {
-	r = room{}
-	r.listener, err = net.Listen("tcp", ":0")
+func NewRoom(name string, roomSize int, cfg RoomConfig) (r *room, err error) {
+	r = &room{name: name, createdAt: time.Now(), cfg: cfg}
+	r.id, err = newRoomID()
 	if err != nil {
-		return
+		return nil, err
 	}
-	r.clients = make(map[client]bool, roomSize)
+	r.clients = make(map[*client]bool, roomSize)
+	r.ips = newIPStore()
 	r.sema = make(chan any, roomSize)
-	r.messages = make(chan message)
-	r.toEnter = make(chan client)
-	r.toLeave = make(chan client)
+	r.messages = make(chan post)
+	r.toEnter = make(chan *client)
+	r.toLeave = make(chan *client)
+	r.toDrain = make(chan string)
+	r.commands = builtinCommands
 	r.close = make(chan any)
+	r.closed = make(chan any)
 	return
 }
 
-func (r *room) GetPort() int {
-	return r.listener.Addr().(*net.TCPAddr).Port
+func newRoomID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("error while generating room id: %s", err)
+	}
+	return hex.EncodeToString(id), nil
 }
 
-func (r *room) Open() {
-	go r.roomMonitor()
+func (r *room) GetID() string {
+	return r.id
+}
 
-	for {
-		conn, err := r.listener.Accept()
-		if err != nil {
-			select {
-			case <-r.close:
-				return
-			default:
-				continue
-			}
-		}
-		go r.handleConn(conn)
+func (r *room) GetSize() int {
+	return cap(r.sema)
+}
+
+// GetMembers returns the current number of clients in the room. Unlike
+// len(r.clients) it is safe to call from outside of roomMonitor.
+func (r *room) GetMembers() int {
+	return int(atomic.LoadInt32(&r.members))
+}
+
+func (r *room) info() *butlerpb.RoomInfo {
+	return &butlerpb.RoomInfo{
+		Name:      r.name,
+		Size:      int32(r.GetSize()),
+		Members:   int32(r.GetMembers()),
+		CreatedAt: timestamppb.New(r.createdAt),
+		Creator:   r.creator,
+		Private:   r.isPrivate(),
+	}
+}
+
+func (r *room) isPrivate() bool {
+	return r.passwordHash != nil
+}
+
+func (r *room) setPassword(password string) (err error) {
+	if password == "" {
+		r.passwordHash = nil
+		return nil
+	}
+	r.passwordHash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return err
+}
+
+func (r *room) checkPassword(password string) bool {
+	if !r.isPrivate() {
+		return true
 	}
+	return bcrypt.CompareHashAndPassword(r.passwordHash, []byte(password)) == nil
+}
+
+// Open runs the room until it gets closed, see RoomConfig for when that
+// happens. It returns the reason the room was closed for.
+func (r *room) Open() string {
+	r.chatLog.write(logRecord{Time: time.Now().UTC(), Room: r.name, Event: "open", Sender: r.creator})
+	r.roomMonitor()
+	r.chatLog.write(logRecord{Time: time.Now().UTC(), Room: r.name, Event: "close", Text: r.closeReason})
+	r.chatLog.close()
+	close(r.closed)
+	return r.closeReason
+}
+
+// record appends a message sent to the whole room to its log, if it keeps
+// one. addr is the address of the client the event is about, if any.
+func (r *room) record(event string, msg message, addr string) {
+	r.chatLog.write(logRecord{
+		Time:   msg.sentAt,
+		Room:   r.name,
+		Event:  event,
+		ID:     msg.id,
+		Seq:    msg.seq,
+		Sender: msg.sender,
+		Addr:   addr,
+		Text:   msg.text,
+	})
 }
 
 func (r *room) roomMonitor() {
+	// expire fires when the room has stayed empty for too long, it is nil
+	// while there are clients in the room.
+	var expire <-chan time.Time
+	var expireReason string
+	var expireTimer *time.Timer
+	startExpire := func(timeout time.Duration, reason string) {
+		expireTimer = time.NewTimer(timeout)
+		expire = expireTimer.C
+		expireReason = reason
+	}
+	defer func() {
+		if expireTimer != nil {
+			expireTimer.Stop()
+		}
+	}()
+	if r.cfg.JoinTimeout > 0 {
+		startExpire(r.cfg.JoinTimeout, fmt.Sprintf("nobody joined within %s", r.cfg.JoinTimeout))
+	}
+	// draining is set once the server is shutting down, the room then
+	// closes as soon as its clients have been sent what they have queued.
+	var draining bool
+
 	for {
 		select {
-		case msg := <-r.messages:
+		case <-expire:
+			r.shutdown(expireReason)
+			return
+		case notice := <-r.toDrain:
+			if draining {
+				continue
+			}
+			draining = true
+			msg := r.stamp(message{text: notice})
+			r.broadcast(msg)
+			r.record("notice", msg, "")
 			for cl := range r.clients {
-				if cl.name != msg.sender {
-					cl.messages <- msg
-				}
+				cl.member.stopRecv()
+			}
+			if len(r.clients) == 0 {
+				r.shutdown("server shutting down")
+				return
+			}
+		case p := <-r.messages:
+			if !r.admitPost(p) {
+				continue
+			}
+			if p.invalid != nil {
+				r.strike(p, p.invalid)
+				continue
+			}
+			var err error
+			if p.text, err = r.checkText(p); err != nil {
+				r.deliver(p.from, rejectionOf(p, err))
+				continue
+			}
+			ack := message{kind: ackMessage, ref: p.ref}
+			if isCommand(p.text) {
+				r.runCommand(p)
+			} else {
+				msg := r.stamp(message{sender: p.from.name, text: unescapeCommand(p.text)})
+				r.fanOut(msg, p.from)
+				r.metrics.sent(msg.text)
+				r.remember(msg)
+				r.record("chat", msg, "")
+				ack.id, ack.seq = msg.id, msg.seq
+			}
+			if p.ref != "" {
+				r.deliver(p.from, ack)
 			}
 		case cl := <-r.toEnter:
-			r.clients[cl] = true
-			enterMsg := message{text: cl.name + " joined"}
-			for cli := range r.clients {
-				cli.messages <- enterMsg
+			if draining {
+				cl.admitted <- errShuttingDown()
+				continue
 			}
+			if err := r.checkNickname(cl.name, cl); err != nil {
+				cl.admitted <- err
+				continue
+			}
+			if err := r.admitJoin(cl); err != nil {
+				cl.admitted <- err
+				continue
+			}
+			cl.name = cl.displayName(cl.name)
+			r.writers.Add(1)
+			cl.admitted <- nil
+			if expireTimer != nil {
+				expireTimer.Stop()
+				expire = nil
+			}
+			r.clients[cl] = true
+			r.membersChanged()
+			r.metrics.joined()
+			r.deliver(cl, r.presence())
+			r.replay(cl)
+			join := r.stamp(message{kind: joinMessage, sender: cl.name})
+			r.broadcast(join)
+			r.record("join", join, cl.addr)
 
 		case cl := <-r.toLeave:
-			close(cl.messages)
+			cl.out.close()
 			delete(r.clients, cl)
+			r.forgetFlood(cl)
+			r.membersChanged()
+			r.metrics.left()
 
-			leaveMsg := message{text: cl.name + " left"}
-			for cli := range r.clients {
-				cli.messages <- leaveMsg
+			leave := r.stamp(message{kind: leaveMessage, sender: cl.name})
+			if !draining {
+				r.broadcast(leave)
 			}
+			r.record("leave", leave, cl.addr)
 
 			if len(r.clients) == 0 {
-				log.Printf("room at port %d is empty, closing it", r.GetPort())
-				err := r.listener.Close()
-				if err != nil {
-					log.Println(err)
+				if draining {
+					r.shutdown("server shutting down")
+					return
 				}
-				close(r.close)
-				return
+				if r.cfg.IdleTimeout == 0 {
+					r.shutdown("last client left")
+					return
+				}
+				startExpire(r.cfg.IdleTimeout, fmt.Sprintf("no clients for %s", r.cfg.IdleTimeout))
 			}
 		}
 	}
 }
 
-func (r *room) handleConn(conn net.Conn) {
-	r.sema <- struct{}{}
-	defer func() { <-r.sema }()
+// checkText returns the text of p with the control characters removed, or an
+// error if the room doesn't accept it.
+func (r *room) checkText(p post) (string, error) {
+	max := r.cfg.MaxMessageSize
+	if max <= 0 {
+		max = defaultMaxMessageSize
+	}
+	if p.tooLong || len(p.text) > max {
+		return "", errMessageTooLong(max)
+	}
+	if !utf8.ValidString(p.text) {
+		return "", errInvalidArgument("text", "message is not valid UTF-8")
+	}
+	return stripControl(p.text), nil
+}
+
+// stripControl turns the control characters of text that are whitespace into
+// spaces and removes the other ones, such as terminal escape sequences.
+func stripControl(text string) string {
+	return strings.Map(func(c rune) rune {
+		switch {
+		case !unicode.IsControl(c):
+			return c
+		case unicode.IsSpace(c):
+			return ' '
+		}
+		return -1
+	}, text)
+}
+
+// checkNickname reports why self, a client entering the room or asking to be
+// renamed, can't be called name. Guests can't use the names of accounts. It
+// must only be called by roomMonitor.
+func (r *room) checkNickname(name string, self *client) error {
+	if err := r.cfg.Nicknames.validateNickname(name); err != nil {
+		return err
+	}
+	if self.guest {
+		registered, err := r.accounts.registered(name)
+		if err != nil {
+			return err
+		}
+		if registered {
+			return errNameRegistered(name)
+		}
+	}
+	name = self.displayName(name)
+	for cl := range r.clients {
+		if cl != self && strings.EqualFold(cl.name, name) {
+			return errNicknameTaken(name)
+		}
+	}
+	return nil
+}
+
+// presence lists the room's clients in alphabetical order. It must only be
+// called by roomMonitor.
+func (r *room) presence() message {
+	names := make([]string, 0, len(r.clients))
+	for cl := range r.clients {
+		names = append(names, cl.name)
+	}
+	sort.Strings(names)
+	return message{kind: presenceMessage, members: names}
+}
+
+// stamp assigns msg the next sequence number of the room, an id and the time
+// it is sent at. It must only be called by roomMonitor.
+func (r *room) stamp(msg message) message {
+	r.seq++
+	msg.seq = r.seq
+	msg.id = fmt.Sprintf("%s-%d", r.id, r.seq)
+	msg.sentAt = time.Now().UTC()
+	return msg
+}
+
+// remember adds msg to the room's history, dropping the entries that no
+// longer fit. It must only be called by roomMonitor.
+func (r *room) remember(msg message) {
+	if r.cfg.HistorySize <= 0 {
+		return
+	}
+	r.history = append(r.history, msg)
+	if drop := len(r.history) - r.cfg.HistorySize; drop > 0 {
+		// copy so that the dropped entries don't pin the backing array
+		r.history = append([]message(nil), r.history[drop:]...)
+	}
+}
+
+// replay sends the history to a client that has just joined the room. It
+// must only be called by roomMonitor.
+func (r *room) replay(cl *client) {
+	if r.cfg.HistoryAge > 0 {
+		cutoff := time.Now().Add(-r.cfg.HistoryAge)
+		expired := 0
+		for expired < len(r.history) && r.history[expired].sentAt.Before(cutoff) {
+			expired++
+		}
+		r.history = r.history[expired:]
+	}
+	// leave room in the client's queue for the presence before and the
+	// join after the history
+	history := r.history
+	if n := cl.out.limit - 2; len(history) > n && n > 0 {
+		history = history[len(history)-n:]
+	}
+	for _, msg := range history {
+		msg.replayed = true
+		r.deliver(cl, msg)
+	}
+}
+
+// broadcast sends msg to every client in the room. It must only be called by
+// roomMonitor.
+func (r *room) broadcast(msg message) {
+	r.fanOut(msg, nil)
+}
+
+// fanOut sends msg to every client in the room but skip, which may be nil,
+// and records how long that took. It must only be called by roomMonitor.
+func (r *room) fanOut(msg message, skip *client) {
+	start := time.Now()
+	for cl := range r.clients {
+		if cl != skip {
+			r.deliver(cl, msg)
+		}
+	}
+	r.metrics.fannedOut(time.Since(start))
+}
+
+// deliver queues msg for cl. A client whose queue is full is evicted if the
+// room's overflow policy says so. It must only be called by roomMonitor.
+func (r *room) deliver(cl *client, msg message) {
+	if cl.out.push(msg) {
+		return
+	}
+	log.Printf("evicting %s (%s) from room \"%s\": %d messages behind", cl.name, cl.addr, r.name, cl.out.limit)
+	r.kick(cl, errSlowClient(cl.out.limit))
+}
+
+// kick makes cl leave the room, sending it err instead of the messages it
+// still has queued. It must only be called by roomMonitor.
+func (r *room) kick(cl *client, err error) {
+	cl.out.evict(rejection(err))
+	cl.member.stopRecv()
+}
+
+// drain sends notice to the room's clients and makes them leave once they
+// have been sent every message queued for them, closing the room. It doesn't
+// wait for the room to close.
+func (r *room) drain(notice string) {
+	select {
+	case r.toDrain <- notice:
+	case <-r.close:
+	}
+}
+
+// drained is closed once the room has closed, its log has been closed and its
+// clients have been sent every message queued for them.
+func (r *room) drained() <-chan struct{} {
+	drained := make(chan struct{})
+	go func() {
+		<-r.closed
+		r.writers.Wait()
+		close(drained)
+	}()
+	return drained
+}
+
+func (r *room) shutdown(reason string) {
+	log.Printf("closing room \"%s\" (%s): %s", r.name, r.id, reason)
+	r.closeReason = reason
+	close(r.close)
+}
+
+func (r *room) membersChanged() {
+	atomic.StoreInt32(&r.members, int32(len(r.clients)))
+	r.metrics.setClients(r.name, len(r.clients))
+	if r.onChange != nil {
+		r.onChange()
+	}
+}
+
+// handleConn serves a framed connection that has already been routed to the
+// room by its hello frame. rd is the connection's reader positioned right
+// after the hello frame.
+func (r *room) handleConn(conn net.Conn, rd io.Reader, hello *wire.Frame) {
+	defer conn.Close()
+	m := newFrameMember(conn, rd)
+	if !r.checkPassword(hello.Password) {
+		log.Printf("%s (%s) failed to enter room \"%s\": invalid password", hello.Name, m.remoteAddr(), r.name)
+		r.reject(m, errInvalidPassword(r.name))
+		return
+	}
+
+	id, err := r.identify(m.tlsState(), hello.Token, hello.Name)
+	if err == nil {
+		err = r.checkTicket(hello.Ticket, id)
+	}
+	if err != nil {
+		log.Printf("%s (%s) failed to enter room \"%s\": %s", hello.Name, m.remoteAddr(), r.name, err)
+		r.reject(m, err)
+		return
+	}
+
+	log.Printf("new connection in room %s is %s", r.id, id.name)
+	if err := r.serve(id, m); err != nil {
+		r.reject(m, err)
+	}
+}
+
+// handleLineConn serves a plain-text connection that has already been routed
+// to the room by its first line, which held ticket if it wasn't just the room
+// id. rd is the connection's reader positioned right after that line.
+func (r *room) handleLineConn(conn net.Conn, rd io.Reader, ticket string) {
 	defer conn.Close()
+	log.Printf("new unnamed connection in room %s\n", r.id)
+	r.handshake(newLineMember(conn, rd), ticket)
+}
 
-	log.Printf("new unnamed connection in room %d\n", r.GetPort())
-	input := bufio.NewScanner(conn)
-	cl := client{}
-	cl.addr = conn.RemoteAddr().String()
-	cl.messages = make(chan message)
-	cl.done = make(chan struct{})
-	input.Scan()
-	cl.name = input.Text()
+// reject tells m why it can't join the room.
+func (r *room) reject(m member, err error) {
+	r.metrics.rejectedConn(err)
+	m.send(rejection(err))
+}
 
-	log.Printf("new unnamed connection in room %d is %s", r.GetPort(), cl.name)
-	go r.messageWriter(conn, cl)
+// tokenPrefix starts the first line of a line-based member joining with a
+// session token instead of a user name.
+const tokenPrefix = "/token "
 
-	r.toEnter <- cl
-	for input.Scan() {
-		r.messages <- message{sender: cl.name, text: input.Text()}
+// handshake reads the user name, or a session token, and for private rooms
+// the password sent as the first lines of a line-based member and then serves
+// it. ticket is the join ticket the member was routed to the room with, if
+// any.
+func (r *room) handshake(m member, ticket string) {
+	name, _ := m.recv()
+	var token string
+	if strings.HasPrefix(name.text, tokenPrefix) {
+		token, name.text = strings.TrimSpace(name.text[len(tokenPrefix):]), ""
+	}
+	if r.isPrivate() {
+		password, _ := m.recv()
+		if !r.checkPassword(password.text) {
+			log.Printf("%s (%s) failed to enter room \"%s\": invalid password", name.text, m.remoteAddr(), r.name)
+			r.reject(m, errInvalidPassword(r.name))
+			return
+		}
+	}
+
+	id, err := r.identify(m.tlsState(), token, name.text)
+	if err == nil {
+		err = r.checkTicket(ticket, id)
+	}
+	if err != nil {
+		log.Printf("%s (%s) failed to enter room \"%s\": %s", name.text, m.remoteAddr(), r.name, err)
+		r.reject(m, err)
+		return
+	}
+
+	log.Printf("new unnamed connection in room %s is %s", r.id, id.name)
+	if err := r.serve(id, m); err != nil {
+		r.reject(m, err)
+	}
+}
+
+// serve runs a member that has completed its transport's handshake until it
+// disconnects. It returns an error without serving the member if the member
+// can't join the room, e.g. because its name is already taken.
+func (r *room) serve(id identity, m member) error {
+	// the handshake is over, clients may stay quiet as long as they like
+	// once they are in
+	m.setReadDeadline(time.Time{})
+	name := id.name
+	if err := r.cfg.Nicknames.validateNickname(name); err != nil {
+		return err
+	}
+	select {
+	case r.sema <- struct{}{}:
+	case <-r.close:
+		return errRoomClosed(r.name)
+	}
+	defer func() { <-r.sema }()
+
+	cl := &client{}
+	cl.name = name
+	cl.loggedIn, cl.guest = id.loggedIn, id.guest
+	cl.addr = m.remoteAddr()
+	cl.out = newOutbox(r.cfg.QueueSize, r.cfg.Overflow)
+	cl.member = m
+	cl.admitted = make(chan error, 1)
+	select {
+	case r.toEnter <- cl:
+	case <-r.close:
+		return errRoomClosed(r.name)
+	}
+	if err := <-cl.admitted; err != nil {
+		log.Printf("%s (%s) failed to enter room \"%s\": %s", name, cl.addr, r.name, err)
+		return err
+	}
+	writerDone := make(chan struct{})
+	go r.messageWriter(m, cl, writerDone)
+
+	for {
+		p, err := m.recv()
+		if err != nil {
+			break
+		}
+		p.from = cl
+		r.messages <- p
 	}
-	close(cl.done)
 	r.toLeave <- cl
+	<-writerDone
+	return nil
 }
 
-func (r *room) messageWriter(conn net.Conn, cl client) {
+// messageWriter delivers the client's messages until roomMonitor closes its
+// outbox. A member that can't be written to within the room's write timeout
+// is made to leave the room.
+func (r *room) messageWriter(m member, cl *client, done chan<- struct{}) {
+	defer r.writers.Done()
+	defer close(done)
+	var err error
 	for {
-		select {
-		case msg := <-cl.messages:
-			fmt.Fprintln(conn, msg.String())
-		case <-cl.done:
+		msg, ok := cl.out.pop()
+		if !ok {
 			return
 		}
+		if err != nil {
+			continue
+		}
+		if r.cfg.WriteTimeout > 0 {
+			m.setWriteDeadline(time.Now().Add(r.cfg.WriteTimeout))
+		}
+		if err = m.send(msg); err != nil {
+			log.Printf("error while writing to %s (%s) in room \"%s\": %s", cl.name, cl.addr, r.name, err)
+			m.stopRecv()
+		} else if r.cfg.WriteTimeout > 0 {
+			// cleared so that the deadline only ever applies to the
+			// message being sent
+			m.setWriteDeadline(time.Time{})
+		}
 	}
 }
@@ -2,46 +2,108 @@ package server
 
 import (
 	"bufio"
-	"errors"
+	"context"
+	"fmt"
+	"io"
 	"net"
-	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
 
 	"github.com/dimaglushkov/go-chat/api/butlerpb"
+	"github.com/dimaglushkov/go-chat/internal/wire"
 )
 
-func connectToRoom(rp *butlerpb.RoomPort) (*net.TCPConn, error) {
-	tcpAddr, _ := net.ResolveTCPAddr("tcp", "localhost:"+strconv.FormatInt(int64(rp.Port), 10))
-	return net.DialTCP("tcp", nil, tcpAddr)
+// testClient is a framed connection to the room port.
+type testClient struct {
+	conn net.Conn
+	r    *wire.Reader
 }
 
-func sendMsg(sender *bufio.Writer, msg string) error {
-	time.Sleep(time.Second / 2)
-
-	if sender == nil {
-		return errors.New("sender is nil")
-	}
-	if len(msg) == 0 {
-		return errors.New("msg is empty")
-	}
-	if msg[len(msg)-1] != '\n' {
-		msg += "\n"
+// dialRoom connects to the room port and sends hello without waiting for the
+// answer. The room and version are filled in unless set.
+func dialRoom(t testing.TB, addr string, hello wire.Frame) *testClient {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	if hello.Version == 0 {
+		hello.Version = wire.Version
 	}
-	_, err := sender.WriteString(msg)
-	if err != nil {
-		return err
+	hello.Type = wire.TypeHello
+	c := &testClient{conn: conn, r: wire.NewReader(conn)}
+	c.send(t, hello)
+	return c
+}
+
+// joinTestClient joins the room as name and reads the frames confirming it.
+func joinTestClient(t testing.TB, addr string, ref *butlerpb.RoomRef, name string) *testClient {
+	c := dialRoom(t, addr, wire.Frame{Room: ref.Id, Name: name})
+	assert.Equal(t, wire.TypeHello, c.next(t).Type)
+	assert.Equal(t, wire.TypePresence, c.next(t).Type)
+	c.expect(t, name+" joined")
+	return c
+}
+
+func (c *testClient) send(t testing.TB, f wire.Frame) {
+	require.NoError(t, wire.Write(c.conn, &f))
+}
+
+func (c *testClient) say(t testing.TB, text string) {
+	c.send(t, wire.Frame{Type: wire.TypeChat, Text: text})
+}
+
+func (c *testClient) next(t testing.TB) *wire.Frame {
+	c.conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	f, err := c.r.Read()
+	require.NoError(t, err)
+	return f
+}
+
+// expect reads the next frame and compares it to line rendered the way the
+// line protocol shows it.
+func (c *testClient) expect(t testing.TB, line string) {
+	f := c.next(t)
+	var got string
+	switch f.Type {
+	case wire.TypeChat:
+		got = f.Text
+		if f.Sender != "" {
+			got = f.Sender + ": " + f.Text
+		}
+	case wire.TypeSystem:
+		got = systemPrefix + f.Text
+	case wire.TypeJoin:
+		got = f.Name + " joined"
+	case wire.TypeLeave:
+		got = f.Name + " left"
+	case wire.TypeError:
+		got = systemPrefix + "rejected: " + f.Text
+	default:
+		got = fmt.Sprintf("%s frame", f.Type)
 	}
-	err = sender.Flush()
-	time.Sleep(time.Second / 2)
-	return err
+	assert.Equal(t, line, got)
+}
+
+// unstamped clears the fields the server stamps frames with.
+func unstamped(f *wire.Frame) *wire.Frame {
+	f.ID, f.Seq, f.Time = "", 0, 0
+	return f
+}
+
+// expectClosed checks the server has closed the connection.
+func (c *testClient) expectClosed(t *testing.T) {
+	c.conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	_, err := c.r.Read()
+	assert.ErrorIs(t, err, io.EOF)
 }
 
 func TestRoom_Open(t *testing.T) {
 	var done = make(chan struct{})
-	r, err := NewRoom(10)
+	r, err := NewRoom("testRoom", 10, RoomConfig{})
 	require.NoError(t, err)
 
 	go func() {
@@ -49,16 +111,283 @@ func TestRoom_Open(t *testing.T) {
 		done <- struct{}{}
 	}()
 
-	conn, err := connectToRoom(&butlerpb.RoomPort{Port: int32(r.GetPort())})
+	conn, roomConn := net.Pipe()
+	go r.handleConn(roomConn, roomConn, &wire.Frame{Type: wire.TypeHello, Name: "my_name"})
+	c := &testClient{conn: conn, r: wire.NewReader(conn)}
+	assert.Equal(t, wire.TypePresence, c.next(t).Type)
+	c.expect(t, "my_name joined")
+
+	conn.Close()
+	assert.Error(t, wire.Write(conn, &wire.Frame{Type: wire.TypeChat, Text: "test"}))
+	<-done
+}
+
+func openRoom(r *room) <-chan string {
+	closed := make(chan string, 1)
+	go func() {
+		closed <- r.Open()
+	}()
+	return closed
+}
+
+func TestRoom_JoinTimeout(t *testing.T) {
+	r, err := NewRoom("testRoom", 10, RoomConfig{JoinTimeout: 100 * time.Millisecond})
 	require.NoError(t, err)
 
-	w := bufio.NewWriter(conn)
+	select {
+	case reason := <-openRoom(r):
+		require.Contains(t, reason, "nobody joined")
+	case <-time.After(3 * time.Second):
+		t.Fatal("unjoined room was not closed")
+	}
+}
 
-	err = sendMsg(w, "my_name")
+func TestRoom_IdleTimeout(t *testing.T) {
+	r, err := NewRoom("testRoom", 10, RoomConfig{JoinTimeout: time.Second, IdleTimeout: 2 * time.Second})
 	require.NoError(t, err)
+	closed := openRoom(r)
 
+	conn, roomConn := net.Pipe()
+	go r.handleConn(roomConn, roomConn, &wire.Frame{Type: wire.TypeHello, Name: "my_name"})
+	go io.Copy(io.Discard, conn)
+	require.Eventually(t, func() bool { return r.GetMembers() == 1 }, time.Second, 10*time.Millisecond)
+
+	// the join timeout must not fire once somebody has joined
+	time.Sleep(2 * time.Second)
 	conn.Close()
-	err = sendMsg(w, "test")
-	require.Error(t, err)
-	<-done
+	require.Eventually(t, func() bool { return r.GetMembers() == 0 }, time.Second, 10*time.Millisecond)
+
+	select {
+	case <-closed:
+		t.Fatal("room was closed before its idle timeout")
+	case <-time.After(time.Second):
+	}
+	select {
+	case reason := <-closed:
+		require.Contains(t, reason, "no clients")
+	case <-time.After(3 * time.Second):
+		t.Fatal("idle room was not closed")
+	}
+}
+
+func TestRoom_Frames(t *testing.T) {
+	butler := NewButler(Config{})
+	addr := serveRooms(t, &butler)
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "frames", Size: 5})
+	require.NoError(t, err)
+
+	alice := joinTestClient(t, addr, ref, "alice")
+	bob := joinTestClient(t, addr, ref, "bob")
+	alice.expect(t, "bob joined")
+
+	alice.send(t, wire.Frame{Type: wire.TypeChat, Text: "hi", Ref: "1"})
+	bob.expect(t, "alice: hi")
+	assert.Equal(t, &wire.Frame{Type: wire.TypeAck, Ref: "1"}, unstamped(alice.next(t)))
+
+	// invalid frames are answered with an error and don't end the session
+	_, err = alice.conn.Write([]byte("{\"type\":\"chat\"\n"))
+	require.NoError(t, err)
+	reply := alice.next(t)
+	assert.Equal(t, wire.TypeError, reply.Type)
+	assert.Equal(t, codes.InvalidArgument.String(), reply.Code)
+	alice.send(t, wire.Frame{Type: wire.TypeHello, Version: wire.Version})
+	alice.expect(t, "*** rejected: invalid frame: unexpected hello frame")
+
+	alice.say(t, "still here")
+	bob.expect(t, "alice: still here")
+}
+
+// lineClient is a connection to the room port speaking the plain-text
+// protocol.
+type lineClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dialRoomLines connects to the room port and sends the room id followed by
+// lines.
+func dialRoomLines(t *testing.T, addr, id string, lines ...string) *lineClient {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	c := &lineClient{conn: conn, r: bufio.NewReader(conn)}
+	for _, line := range append([]string{id}, lines...) {
+		c.say(t, line)
+	}
+	return c
+}
+
+func (c *lineClient) say(t *testing.T, line string) {
+	_, err := fmt.Fprintln(c.conn, line)
+	require.NoError(t, err)
+}
+
+func (c *lineClient) expect(t *testing.T, line string) {
+	c.conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	got, err := c.r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, line+"\n", got)
+}
+
+func TestRoom_LineProtocol(t *testing.T) {
+	butler := NewButler(Config{})
+	addr := serveRooms(t, &butler)
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "lines", Size: 5})
+	require.NoError(t, err)
+
+	legacy := dialRoomLines(t, addr, ref.Id, "legacy")
+	legacy.expect(t, "legacy joined")
+	framed := joinTestClient(t, addr, ref, "framed")
+	legacy.expect(t, "framed joined")
+
+	legacy.say(t, "hello from the past")
+	framed.expect(t, "legacy: hello from the past")
+	framed.send(t, wire.Frame{Type: wire.TypeChat, Text: "hello from the future", Ref: "1"})
+	legacy.expect(t, "framed: hello from the future")
+	framed.expect(t, "ack frame")
+
+	// events without a plain-text rendering, like presence and acks, are
+	// not sent to plain-text clients
+	framed.say(t, "/nick modern")
+	legacy.expect(t, "framed is now known as modern")
+	framed.expect(t, "presence frame")
+	framed.expect(t, "framed is now known as modern")
+	legacy.say(t, "/who")
+	legacy.expect(t, "*** 2 in the room: legacy, modern")
+
+	dialRoomLines(t, addr, ref.Id, "Legacy").expect(t, `*** rejected: user name "Legacy" is already taken in this room`)
+	dialRoomLines(t, addr, "missing").expect(t, `*** rejected: room "missing" does not exist`)
+
+	private, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "private lines", Size: 5, Password: "pass"})
+	require.NoError(t, err)
+	dialRoomLines(t, addr, private.Id, "legacy", "guess").expect(t, `*** rejected: invalid password for room "private lines"`)
+	dialRoomLines(t, addr, private.Id, "legacy", "pass").expect(t, "legacy joined")
+
+	legacy.conn.Close()
+	framed.expect(t, "legacy left")
+}
+
+func TestRoom_HandshakeTimeout(t *testing.T) {
+	timeout := handshakeTimeout
+	handshakeTimeout = 200 * time.Millisecond
+	t.Cleanup(func() { handshakeTimeout = timeout })
+	butler := NewButler(Config{})
+	addr := serveRooms(t, &butler)
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "patient", Size: 5})
+	require.NoError(t, err)
+
+	alice := dialRoomLines(t, addr, ref.Id, "alice")
+	alice.expect(t, "alice joined")
+
+	// a client that names the room but not itself is let go
+	idle := dialRoomLines(t, addr, ref.Id)
+	idle.conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	_, err = io.ReadAll(idle.r)
+	assert.NoError(t, err)
+
+	// the deadline is gone once the client is in
+	time.Sleep(300 * time.Millisecond)
+	alice.say(t, "/who")
+	alice.expect(t, "*** 1 in the room: alice")
+}
+
+func TestRoom_MessageValidation(t *testing.T) {
+	butler := NewButler(Config{Room: RoomConfig{MaxMessageSize: 16}})
+	addr := serveRooms(t, &butler)
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "strict", Size: 5})
+	require.NoError(t, err)
+
+	alice := joinTestClient(t, addr, ref, "alice")
+	bob := dialRoomLines(t, addr, ref.Id, "bob")
+	bob.expect(t, "bob joined")
+	alice.expect(t, "bob joined")
+
+	alice.send(t, wire.Frame{Type: wire.TypeChat, Text: strings.Repeat("a", 17), Ref: "1"})
+	reply := alice.next(t)
+	assert.Equal(t, wire.TypeError, reply.Type)
+	assert.Equal(t, codes.InvalidArgument.String(), reply.Code)
+	assert.Equal(t, "1", reply.Ref)
+	assert.Equal(t, "invalid text: message is longer than 16 bytes", reply.Text)
+
+	// frames the transport can't read are rejected the same way
+	_, err = fmt.Fprintf(alice.conn, "{\"type\":\"chat\",\"text\":\"%s\"}\n", strings.Repeat("a", wire.MaxFrameSize))
+	require.NoError(t, err)
+	alice.expect(t, "*** rejected: invalid text: message is longer than 16 bytes")
+	bob.say(t, strings.Repeat("b", 2*wire.MaxFrameSize))
+	bob.expect(t, "*** rejected: invalid text: message is longer than 16 bytes")
+
+	bob.say(t, "caf\xe9")
+	bob.expect(t, "*** rejected: invalid text: message is not valid UTF-8")
+
+	// control characters are stripped, whitespace ones become spaces
+	alice.say(t, "\x1b[31mred\x1b[0m\tok")
+	bob.expect(t, "alice: [31mred[0m ok")
+	bob.say(t, "still \u00e9\x07here")
+	alice.expect(t, "bob: still \u00e9here")
+}
+
+func TestRoom_History(t *testing.T) {
+	butler := NewButler(Config{Room: RoomConfig{HistorySize: 2, HistoryAge: time.Second}})
+	addr := serveRooms(t, &butler)
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "history", Size: 5})
+	require.NoError(t, err)
+
+	alice := joinTestClient(t, addr, ref, "alice")
+	for _, text := range []string{"one", "two", "/me counts", "/help"} {
+		alice.send(t, wire.Frame{Type: wire.TypeChat, Text: text, Ref: text})
+	}
+	// the last ack tells all of them have been handled
+	for alice.next(t).Ref != "/help" {
+	}
+
+	bob := dialRoom(t, addr, wire.Frame{Room: ref.Id, Name: "bob"})
+	assert.Equal(t, wire.TypeHello, bob.next(t).Type)
+	assert.Equal(t, wire.TypePresence, bob.next(t).Type)
+	assert.Equal(t, &wire.Frame{Type: wire.TypeChat, Sender: "alice", Text: "two", Replayed: true}, unstamped(bob.next(t)))
+	assert.Equal(t, &wire.Frame{Type: wire.TypeChat, Text: "* alice counts", Replayed: true}, unstamped(bob.next(t)))
+	bob.expect(t, "bob joined")
+
+	time.Sleep(time.Second)
+	carol := dialRoom(t, addr, wire.Frame{Room: ref.Id, Name: "carol"})
+	assert.Equal(t, wire.TypeHello, carol.next(t).Type)
+	assert.Equal(t, wire.TypePresence, carol.next(t).Type)
+	carol.expect(t, "carol joined")
+}
+
+func TestRoom_Sequence(t *testing.T) {
+	butler := NewButler(Config{Room: RoomConfig{HistorySize: 10}})
+	addr := serveRooms(t, &butler)
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "sequence", Size: 5})
+	require.NoError(t, err)
+
+	start := time.Now().UnixNano() / int64(time.Millisecond)
+	alice := joinTestClient(t, addr, ref, "alice")
+	bob := joinTestClient(t, addr, ref, "bob")
+	joined := alice.next(t)
+	assert.Equal(t, wire.TypeJoin, joined.Type)
+
+	alice.send(t, wire.Frame{Type: wire.TypeChat, Text: "first", Ref: "a"})
+	first, ack := bob.next(t), alice.next(t)
+	assert.Equal(t, "first", first.Text)
+	assert.Equal(t, "a", ack.Ref)
+	assert.Equal(t, first.Seq, ack.Seq)
+	assert.Equal(t, first.ID, ack.ID)
+	assert.Equal(t, joined.Seq+1, first.Seq)
+
+	// both clients see the notice with the same stamps
+	bob.say(t, "/me replies")
+	notice := alice.next(t)
+	assert.Equal(t, "* bob replies", notice.Text)
+	assert.Equal(t, notice, bob.next(t))
+	assert.Equal(t, first.Seq+1, notice.Seq)
+	assert.NotEqual(t, first.ID, notice.ID)
+	assert.GreaterOrEqual(t, notice.Time, start)
+
+	// replayed messages keep their stamps
+	carol := dialRoom(t, addr, wire.Frame{Room: ref.Id, Name: "carol"})
+	assert.Equal(t, wire.TypeHello, carol.next(t).Type)
+	assert.Equal(t, wire.TypePresence, carol.next(t).Type)
+	assert.Equal(t, first.ID, carol.next(t).ID)
+	assert.Equal(t, notice.ID, carol.next(t).ID)
+	assert.Equal(t, notice.Seq+1, carol.next(t).Seq)
 }
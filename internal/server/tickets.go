@@ -0,0 +1,101 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ticketTTL is how long a join ticket can be used for after it is issued.
+const ticketTTL = 30 * time.Second
+
+// ticket lets the user called name join a room once, see ticketStore.
+type ticket struct {
+	room, name string
+	expires    time.Time
+}
+
+// ticketStore keeps the join tickets FindRoom and CreateRoom issue, so that
+// rooms can only be joined by the clients that went through them. Tickets are
+// formed of the id of their room, a dot and a secret, so they can be sent
+// wherever a room id is expected.
+type ticketStore struct {
+	mu      sync.Mutex
+	tickets map[string]ticket
+}
+
+func newTicketStore() *ticketStore {
+	return &ticketStore{tickets: make(map[string]ticket)}
+}
+
+// issue returns a ticket letting the user called name join the room with id
+// roomID once within ticketTTL.
+func (s *ticketStore) issue(roomID, name string) (string, error) {
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("error while generating join ticket: %s", err)
+	}
+	t := roomID + "." + hex.EncodeToString(secret)
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for other, expired := range s.tickets {
+		if now.After(expired.expires) {
+			delete(s.tickets, other)
+		}
+	}
+	s.tickets[t] = ticket{room: roomID, name: name, expires: now.Add(ticketTTL)}
+	return t, nil
+}
+
+// revoke drops t, issued for a room that couldn't be opened.
+func (s *ticketStore) revoke(t string) {
+	s.mu.Lock()
+	delete(s.tickets, t)
+	s.mu.Unlock()
+}
+
+// redeem uses up t to let the user called name join the room with id roomID.
+// A ticket can only be redeemed once, whether it lets the user in or not.
+func (s *ticketStore) redeem(t, roomID, name string) error {
+	if s == nil {
+		return errInvalidTicket("invalid or expired join ticket, find the room again")
+	}
+	s.mu.Lock()
+	issued, ok := s.tickets[t]
+	delete(s.tickets, t)
+	s.mu.Unlock()
+
+	if !ok || issued.room != roomID || time.Now().After(issued.expires) {
+		return errInvalidTicket("invalid or expired join ticket, find the room again")
+	}
+	if !strings.EqualFold(issued.name, name) {
+		return errInvalidTicket(fmt.Sprintf("join ticket was issued for \"%s\"", issued.name))
+	}
+	return nil
+}
+
+// roomOfTicket returns the id of the room id names, which is either a room id
+// or a ticket, and the ticket if it is one.
+func roomOfTicket(id string) (roomID, t string) {
+	if roomID, _, ok := strings.Cut(id, "."); ok {
+		return roomID, id
+	}
+	return id, ""
+}
+
+// checkTicket redeems the ticket a member joining the room as id presented.
+// Members may only come without one if the room doesn't require tickets.
+func (r *room) checkTicket(t string, id identity) error {
+	if t == "" {
+		if r.cfg.RequireTickets {
+			return errInvalidTicket("a join ticket from FindRoom or CreateRoom is required to join rooms")
+		}
+		return nil
+	}
+	return r.tickets.redeem(t, r.id, id.name)
+}
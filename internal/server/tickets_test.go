@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/dimaglushkov/go-chat/api/butlerpb"
+	"github.com/dimaglushkov/go-chat/internal/wire"
+)
+
+func TestTicketStore(t *testing.T) {
+	store := newTicketStore()
+	ticket, err := store.issue("room", "alice")
+	require.NoError(t, err)
+	roomID, got := roomOfTicket(ticket)
+	assert.Equal(t, "room", roomID)
+	assert.Equal(t, ticket, got)
+	roomID, got = roomOfTicket("room")
+	assert.Equal(t, "room", roomID)
+	assert.Empty(t, got)
+
+	assert.NoError(t, store.redeem(ticket, "room", "Alice"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(store.redeem(ticket, "room", "alice")), "tickets are single-use")
+
+	ticket, err = store.issue("room", "alice")
+	require.NoError(t, err)
+	assert.Error(t, store.redeem(ticket, "other room", "alice"))
+	ticket, err = store.issue("room", "alice")
+	require.NoError(t, err)
+	err = store.redeem(ticket, "room", "mallory")
+	require.Error(t, err)
+	assert.Equal(t, `join ticket was issued for "alice"`, status.Convert(err).Message())
+
+	ticket, err = store.issue("room", "alice")
+	require.NoError(t, err)
+	issued := store.tickets[ticket]
+	issued.expires = time.Now().Add(-time.Second)
+	store.tickets[ticket] = issued
+	assert.Error(t, store.redeem(ticket, "room", "alice"))
+
+	ticket, err = store.issue("room", "alice")
+	require.NoError(t, err)
+	store.revoke(ticket)
+	assert.Error(t, store.redeem(ticket, "room", "alice"))
+
+	// expired tickets are dropped as new ones are issued
+	_, err = store.issue("room", "bob")
+	require.NoError(t, err)
+	for key, issued := range store.tickets {
+		issued.expires = time.Now().Add(-time.Second)
+		store.tickets[key] = issued
+	}
+	_, err = store.issue("room", "dave")
+	require.NoError(t, err)
+	assert.Len(t, store.tickets, 1)
+}
+
+func TestRoom_RequireTickets(t *testing.T) {
+	ctx := context.Background()
+	butler := NewButler(Config{Room: RoomConfig{RequireTickets: true}})
+	addr := serveRooms(t, &butler)
+	chat := butlerpb.NewChatClient(startButler(t, &butler))
+
+	ref, err := butler.CreateRoom(ctx, &butlerpb.RoomNameSize{Name: "tickets", Size: 5, Creator: "alice"})
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(ref.Ticket, ref.Id+"."))
+
+	// knowing the room id isn't enough
+	scanner := dialRoom(t, addr, wire.Frame{Room: ref.Id, Name: "scanner"})
+	assert.Equal(t, wire.TypeHello, scanner.next(t).Type)
+	scanner.expect(t, "*** rejected: a join ticket from FindRoom or CreateRoom is required to join rooms")
+	dialRoomLines(t, addr, ref.Id, "scanner").expect(t, "*** rejected: a join ticket from FindRoom or CreateRoom is required to join rooms")
+
+	alice := dialRoom(t, addr, wire.Frame{Ticket: ref.Ticket, Name: "alice"})
+	assert.Equal(t, wire.TypeHello, alice.next(t).Type)
+	assert.Equal(t, wire.TypePresence, alice.next(t).Type)
+	alice.expect(t, "alice joined")
+
+	// tickets are used up on join
+	again := dialRoom(t, addr, wire.Frame{Ticket: ref.Ticket, Name: "alice2"})
+	assert.Equal(t, wire.TypeHello, again.next(t).Type)
+	again.expect(t, "*** rejected: invalid or expired join ticket, find the room again")
+
+	// and are bound to the user they were issued for
+	found, err := butler.FindRoom(ctx, &butlerpb.RoomName{Name: "tickets", User: "bob"})
+	require.NoError(t, err)
+	dialRoomLines(t, addr, found.Ticket, "mallory").expect(t, `*** rejected: join ticket was issued for "bob"`)
+	found, err = butler.FindRoom(ctx, &butlerpb.RoomName{Name: "tickets", User: "bob"})
+	require.NoError(t, err)
+	dialRoomLines(t, addr, found.Ticket, "bob").expect(t, "bob joined")
+	alice.expect(t, "bob joined")
+
+	// the gRPC transport takes tickets too
+	stream := joinStream(t, chat, &butlerpb.ChatJoin{RoomId: ref.Id, Name: "carol"})
+	_, err = stream.Recv()
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	found, err = butler.FindRoom(ctx, &butlerpb.RoomName{Name: "tickets", User: "carol"})
+	require.NoError(t, err)
+	stream = joinStream(t, chat, &butlerpb.ChatJoin{Ticket: found.Ticket, Name: "carol"})
+	msg, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "carol joined", msg.Text)
+
+	// no ticket is issued without a user name
+	found, err = butler.FindRoom(ctx, &butlerpb.RoomName{Name: "tickets"})
+	require.NoError(t, err)
+	assert.Empty(t, found.Ticket)
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/dimaglushkov/go-chat/api/butlerpb"
+	"github.com/dimaglushkov/go-chat/internal/wire"
+)
+
+// newTestCert generates a self-signed certificate for 127.0.0.1 and returns it
+// with a pool trusting it. It can also sign client certificates, see
+// newTestClientCert.
+func newTestCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "go-chat test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, pool
+}
+
+func TestButler_ServeRoomsTLS(t *testing.T) {
+	cert, pool := newTestCert(t)
+	butler := NewButler(Config{})
+	plainAddr := serveRooms(t, &butler)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go butler.ServeRoomsTLS(listener, &tls.Config{Certificates: []tls.Certificate{cert}})
+	t.Cleanup(func() { listener.Close() })
+
+	require.Eventually(t, func() bool {
+		info, err := butler.GetServerInfo(context.Background(), &butlerpb.ServerInfoRequest{})
+		return err == nil && info.RoomTlsPort == int32(listener.Addr().(*net.TCPAddr).Port)
+	}, time.Second, 10*time.Millisecond)
+
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "secure", Size: 5})
+	require.NoError(t, err)
+	conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{RootCAs: pool})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	alice := &testClient{conn: conn, r: wire.NewReader(conn)}
+	alice.send(t, wire.Frame{Type: wire.TypeHello, Version: wire.Version, Room: ref.Id, Name: "alice"})
+	assert.Equal(t, wire.TypeHello, alice.next(t).Type)
+	assert.Equal(t, wire.TypePresence, alice.next(t).Type)
+	alice.expect(t, "alice joined")
+
+	// both listeners lead to the same rooms
+	bob := joinTestClient(t, plainAddr, ref, "bob")
+	alice.expect(t, "bob joined")
+	bob.say(t, "hi")
+	alice.expect(t, "bob: hi")
+
+	// clients that don't trust the certificate can't connect
+	_, err = tls.Dial("tcp", listener.Addr().String(), &tls.Config{})
+	assert.Error(t, err)
+}
+
+func TestButler_GRPCOverTLS(t *testing.T) {
+	cert, pool := newTestCert(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	butler := NewButler(Config{})
+	grpcServer := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}})))
+	butlerpb.RegisterButlerServer(grpcServer, &butler)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	conn, err := grpc.Dial("127.0.0.1:"+port, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: pool})))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	_, err = butlerpb.NewButlerClient(conn).CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "secure"})
+	assert.NoError(t, err)
+}
+
+// newTestClientCert issues a client certificate for name signed by ca.
+func newTestClientCert(t *testing.T, ca tls.Certificate, name string, emails ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(2),
+		Subject:        pkix.Name{CommonName: name},
+		EmailAddresses: emails,
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Leaf, &key.PublicKey, ca.PrivateKey)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestButler_ClientCerts(t *testing.T) {
+	cert, pool := newTestCert(t)
+	serverConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	butler := NewButler(Config{Room: RoomConfig{RequireClientCerts: true}})
+	plainAddr := serveRooms(t, &butler)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go butler.ServeRoomsTLS(listener, serverConfig)
+	t.Cleanup(func() { listener.Close() })
+	grpcListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	grpcServer := grpc.NewServer(grpc.Creds(credentials.NewTLS(serverConfig)))
+	butlerpb.RegisterButlerServer(grpcServer, &butler)
+	butlerpb.RegisterChatServer(grpcServer, &butler)
+	go grpcServer.Serve(grpcListener)
+	t.Cleanup(grpcServer.Stop)
+
+	aliceCert := newTestClientCert(t, cert, "alice")
+	conn, err := grpc.Dial(grpcListener.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{aliceCert},
+	})))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	ctx := context.Background()
+	ref, err := butlerpb.NewButlerClient(conn).CreateRoom(ctx, &butlerpb.RoomNameSize{Name: "certified", Size: 5, Creator: "mallory"})
+	require.NoError(t, err)
+	rooms, err := butler.ListRooms(ctx, &butlerpb.ListRoomsRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "alice", rooms.Rooms[0].Creator, "the creator comes from the certificate")
+
+	// the name comes from the certificate, not from the join
+	stream := joinStream(t, butlerpb.NewChatClient(conn), &butlerpb.ChatJoin{RoomId: ref.Id, Name: "mallory"})
+	msg, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "alice joined", msg.Text)
+
+	// the subject is preferred to the email addresses
+	bobConn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{newTestClientCert(t, cert, "", "bob@example.com")},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { bobConn.Close() })
+	bob := &testClient{conn: bobConn, r: wire.NewReader(bobConn)}
+	bob.send(t, wire.Frame{Type: wire.TypeHello, Version: wire.Version, Room: ref.Id, Name: "alice"})
+	assert.Equal(t, wire.TypeHello, bob.next(t).Type)
+	assert.Equal(t, []string{"alice", "bob"}, bob.next(t).Members)
+	bob.expect(t, "bob joined")
+	msg, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "bob joined", msg.Text)
+
+	// certified names can't be changed
+	bob.say(t, "/nick robert")
+	bob.expect(t, "*** can't change name: logged in users keep the name of their account")
+
+	// clients without a certificate can't get in
+	noCert, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{RootCAs: pool})
+	if err == nil {
+		t.Cleanup(func() { noCert.Close() })
+		noCert.SetReadDeadline(time.Now().Add(3 * time.Second))
+		_, err = noCert.Read(make([]byte, 1))
+	}
+	assert.Error(t, err)
+	plain := dialRoom(t, plainAddr, wire.Frame{Room: ref.Id, Name: "carol"})
+	assert.Equal(t, wire.TypeHello, plain.next(t).Type)
+	plain.expect(t, "*** rejected: a client certificate is required to join rooms")
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/dimaglushkov/go-chat/api/butlerpb"
+)
+
+// watcherBufferSize is the number of events a watcher may fall behind before
+// it gets dropped. Publishing never blocks, so a slow watcher can't stall
+// room creation or a room's monitor.
+const watcherBufferSize = 64
+
+type roomWatcher struct {
+	prefix  string
+	events  chan *butlerpb.RoomEvent
+	dropped chan struct{}
+	once    sync.Once
+}
+
+func newRoomWatcher(prefix string) *roomWatcher {
+	return &roomWatcher{
+		prefix:  prefix,
+		events:  make(chan *butlerpb.RoomEvent, watcherBufferSize),
+		dropped: make(chan struct{}),
+	}
+}
+
+func (w *roomWatcher) notify(event *butlerpb.RoomEvent) {
+	if !strings.HasPrefix(event.Rooms[0].Name, w.prefix) {
+		return
+	}
+	select {
+	case w.events <- event:
+	default:
+		w.once.Do(func() { close(w.dropped) })
+	}
+}
+
+// publish sends an event about r to every watcher. The caller must hold b.mu,
+// which keeps events in the same order as the registry changes they describe.
+func (b *Butler) publish(eventType butlerpb.RoomEvent_Type, r *room) {
+	if len(b.watchers) == 0 {
+		return
+	}
+	event := &butlerpb.RoomEvent{Type: eventType, Rooms: []*butlerpb.RoomInfo{r.info()}}
+	for w := range b.watchers {
+		w.notify(event)
+	}
+}
+
+// WatchRooms sends a snapshot of the open rooms followed by an event for
+// every room that gets created, closed or changes its number of members.
+func (b *Butler) WatchRooms(req *butlerpb.WatchRoomsRequest, stream butlerpb.Butler_WatchRoomsServer) error {
+	w := newRoomWatcher(req.NamePrefix)
+	snapshot := &butlerpb.RoomEvent{Type: butlerpb.RoomEvent_SNAPSHOT}
+
+	b.mu.Lock()
+	for name, r := range b.rooms {
+		if strings.HasPrefix(name, req.NamePrefix) {
+			snapshot.Rooms = append(snapshot.Rooms, r.info())
+		}
+	}
+	b.watchers[w] = true
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		delete(b.watchers, w)
+		b.mu.Unlock()
+	}()
+
+	sort.Slice(snapshot.Rooms, func(i, j int) bool {
+		return snapshot.Rooms[i].Name < snapshot.Rooms[j].Name
+	})
+	if err := stream.Send(snapshot); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case event := <-w.events:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		case <-w.dropped:
+			return status.Error(codes.ResourceExhausted, "room watcher fell behind, resubscribe to get a fresh snapshot")
+		case <-b.done:
+			return errShuttingDown()
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
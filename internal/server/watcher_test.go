@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/dimaglushkov/go-chat/api/butlerpb"
+)
+
+func startButler(t *testing.T, butler *Butler) *grpc.ClientConn {
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(butler.UnaryInterceptor()), grpc.StreamInterceptor(butler.StreamInterceptor()))
+	butlerpb.RegisterButlerServer(grpcServer, butler)
+	butlerpb.RegisterChatServer(grpcServer, butler)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func recvEvent(t *testing.T, stream butlerpb.Butler_WatchRoomsClient) *butlerpb.RoomEvent {
+	event, err := stream.Recv()
+	require.NoError(t, err)
+	return event
+}
+
+func TestButler_WatchRooms(t *testing.T) {
+	butler := NewButler(Config{})
+	client := butlerpb.NewButlerClient(startButler(t, &butler))
+	addr := serveRooms(t, &butler)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := client.CreateRoom(ctx, &butlerpb.RoomNameSize{Name: "lobby-a", Size: 5})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		resp, err := client.ListRooms(ctx, &butlerpb.ListRoomsRequest{})
+		return err == nil && len(resp.Rooms) == 1
+	}, 3*time.Second, 50*time.Millisecond)
+
+	stream, err := client.WatchRooms(ctx, &butlerpb.WatchRoomsRequest{NamePrefix: "lobby-"})
+	require.NoError(t, err)
+
+	event := recvEvent(t, stream)
+	assert.Equal(t, butlerpb.RoomEvent_SNAPSHOT, event.Type)
+	require.Len(t, event.Rooms, 1)
+	assert.Equal(t, "lobby-a", event.Rooms[0].Name)
+
+	_, err = client.CreateRoom(ctx, &butlerpb.RoomNameSize{Name: "other", Size: 5})
+	require.NoError(t, err)
+	rp, err := client.CreateRoom(ctx, &butlerpb.RoomNameSize{Name: "lobby-b", Size: 5})
+	require.NoError(t, err)
+
+	event = recvEvent(t, stream)
+	assert.Equal(t, butlerpb.RoomEvent_CREATED, event.Type)
+	assert.Equal(t, "lobby-b", event.Rooms[0].Name)
+
+	watched := joinTestClient(t, addr, rp, "watched")
+
+	event = recvEvent(t, stream)
+	assert.Equal(t, butlerpb.RoomEvent_OCCUPANCY_CHANGED, event.Type)
+	assert.Equal(t, int32(1), event.Rooms[0].Members)
+
+	watched.conn.Close()
+	event = recvEvent(t, stream)
+	assert.Equal(t, butlerpb.RoomEvent_OCCUPANCY_CHANGED, event.Type)
+	assert.Equal(t, int32(0), event.Rooms[0].Members)
+
+	event = recvEvent(t, stream)
+	assert.Equal(t, butlerpb.RoomEvent_CLOSED, event.Type)
+	assert.Equal(t, "lobby-b", event.Rooms[0].Name)
+}
+
+func TestButler_SlowWatcherDoesNotBlock(t *testing.T) {
+	butler := NewButler(Config{})
+	w := newRoomWatcher("")
+	butler.watchers[w] = true
+
+	r, err := NewRoom("slow", 1, RoomConfig{})
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 2*watcherBufferSize; i++ {
+			butler.publish(butlerpb.RoomEvent_OCCUPANCY_CHANGED, r)
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked on a slow watcher")
+	}
+	select {
+	case <-w.dropped:
+	default:
+		t.Fatal("slow watcher was not dropped")
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"crypto/tls"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/dimaglushkov/go-chat/internal/wire"
+)
+
+// wsMember is a room member connected through the WebSocket gateway. Every
+// text frame is a single line of the room's line protocol.
+type wsMember struct {
+	ws *websocket.Conn
+}
+
+func (m *wsMember) recv() (post, error) {
+	var text string
+	err := websocket.Message.Receive(m.ws, &text)
+	if err == websocket.ErrFrameTooLarge {
+		return post{tooLong: true}, nil
+	}
+	return post{text: strings.TrimRight(text, "\r\n")}, err
+}
+
+func (m *wsMember) send(msg message) error {
+	line, ok := msg.line()
+	if !ok {
+		return nil
+	}
+	return websocket.Message.Send(m.ws, line)
+}
+
+func (m *wsMember) stopRecv() {
+	m.ws.SetReadDeadline(time.Now())
+}
+
+func (m *wsMember) setReadDeadline(t time.Time) {
+	m.ws.SetReadDeadline(t)
+}
+
+func (m *wsMember) setWriteDeadline(t time.Time) {
+	m.ws.SetWriteDeadline(t)
+}
+
+func (m *wsMember) remoteAddr() string {
+	return m.ws.Request().RemoteAddr
+}
+
+func (m *wsMember) tlsState() *tls.ConnectionState {
+	return m.ws.Request().TLS
+}
+
+// WebSocketHandler returns a handler upgrading requests to /rooms/{id} to
+// WebSocket connections joining the room with that id, which can be a join
+// ticket of the room. After the upgrade the client sends its user name and,
+// for private rooms, the password as the first text frames.
+func (b *Butler) WebSocketHandler() http.Handler {
+	return websocket.Handler(func(ws *websocket.Conn) {
+		defer ws.Close()
+		ws.MaxPayloadBytes = wire.MaxFrameSize
+		if b.isClosing() {
+			b.metrics.rejectedConn(errShuttingDown())
+			line, _ := rejection(errShuttingDown()).line()
+			websocket.Message.Send(ws, line)
+			return
+		}
+		id, ticket := roomOfTicket(strings.TrimPrefix(ws.Request().URL.Path, "/rooms/"))
+
+		cr, ok := b.findRoomByID(id)
+		if !ok {
+			b.metrics.rejectedConn(errRoomNotFound(id))
+			line, _ := rejection(errRoomNotFound(id)).line()
+			websocket.Message.Send(ws, line)
+			return
+		}
+
+		log.Printf("new unnamed websocket connection in room %s\n", cr.id)
+		// the room clears the deadline once the client has joined
+		ws.SetReadDeadline(time.Now().Add(handshakeTimeout))
+		cr.handshake(&wsMember{ws: ws}, ticket)
+	})
+}
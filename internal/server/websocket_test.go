@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+
+	"github.com/dimaglushkov/go-chat/api/butlerpb"
+)
+
+func dialWebSocket(t *testing.T, srv *httptest.Server, id string) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/rooms/" + id
+	ws, err := websocket.Dial(url, "", srv.URL)
+	require.NoError(t, err)
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func wsRecv(t *testing.T, ws *websocket.Conn) string {
+	var text string
+	require.NoError(t, websocket.Message.Receive(ws, &text))
+	return text
+}
+
+func TestButler_WebSocketHandler(t *testing.T) {
+	butler := NewButler(Config{})
+	addr := serveRooms(t, &butler)
+	srv := httptest.NewServer(butler.WebSocketHandler())
+	defer srv.Close()
+
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "web", Size: 5})
+	require.NoError(t, err)
+
+	ws := dialWebSocket(t, srv, ref.Id)
+	require.NoError(t, websocket.Message.Send(ws, "webUser"))
+	assert.Equal(t, "webUser joined", wsRecv(t, ws))
+
+	tcpUser := joinTestClient(t, addr, ref, "tcpUser")
+	assert.Equal(t, "tcpUser joined", wsRecv(t, ws))
+
+	require.NoError(t, websocket.Message.Send(ws, "hello from the web"))
+	tcpUser.expect(t, "webUser: hello from the web")
+
+	tcpUser.say(t, "hello from tcp")
+	assert.Equal(t, "tcpUser: hello from tcp", wsRecv(t, ws))
+}
+
+func TestButler_WebSocketHandshakeTimeout(t *testing.T) {
+	timeout := handshakeTimeout
+	handshakeTimeout = 200 * time.Millisecond
+	t.Cleanup(func() { handshakeTimeout = timeout })
+	butler := NewButler(Config{})
+	srv := httptest.NewServer(butler.WebSocketHandler())
+	defer srv.Close()
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "web", Size: 5})
+	require.NoError(t, err)
+
+	// a client that never names itself is let go
+	idle := dialWebSocket(t, srv, ref.Id)
+	idle.SetReadDeadline(time.Now().Add(3 * time.Second))
+	assert.Contains(t, wsRecv(t, idle), "*** rejected")
+
+	ws := dialWebSocket(t, srv, ref.Id)
+	require.NoError(t, websocket.Message.Send(ws, "webUser"))
+	assert.Equal(t, "webUser joined", wsRecv(t, ws))
+	time.Sleep(300 * time.Millisecond)
+	require.NoError(t, websocket.Message.Send(ws, "/who"))
+	assert.Equal(t, "*** 1 in the room: webUser", wsRecv(t, ws))
+}
+
+func TestButler_WebSocketUnknownRoom(t *testing.T) {
+	butler := NewButler(Config{})
+	srv := httptest.NewServer(butler.WebSocketHandler())
+	defer srv.Close()
+
+	ws := dialWebSocket(t, srv, "missing")
+	assert.Equal(t, "*** rejected: room \"missing\" does not exist", wsRecv(t, ws))
+}
+
+func TestButler_WebSocketShutdown(t *testing.T) {
+	butler := NewButler(Config{})
+	srv := httptest.NewServer(butler.WebSocketHandler())
+	defer srv.Close()
+	ref, err := butler.CreateRoom(context.Background(), &butlerpb.RoomNameSize{Name: "web", Size: 5})
+	require.NoError(t, err)
+
+	require.NoError(t, butler.Shutdown(context.Background(), "bye"))
+	ws := dialWebSocket(t, srv, ref.Id)
+	assert.Equal(t, "*** rejected: server is shutting down", wsRecv(t, ws))
+}
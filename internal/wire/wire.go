@@ -0,0 +1,197 @@
+// Package wire implements the framed protocol spoken on the room port. Every
+// frame is a JSON object on a line of its own with a "type" field telling
+// how to interpret the rest of it.
+//
+// A connection starts with the client sending a hello frame naming the
+// protocol version, the room and the user. The server answers with a hello
+// frame of its own if it speaks that version, which doesn't mean the user
+// has joined yet: that is confirmed by the presence frame that follows, or
+// refused by an error frame before the connection is closed.
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Version is the version of the protocol implemented by this package.
+const Version = 1
+
+// MaxFrameSize is the size of the longest frame a Reader accepts, including
+// the trailing newline.
+const MaxFrameSize = 64 * 1024
+
+type Type string
+
+const (
+	// TypeHello opens a connection. Sent by the client it carries Version,
+	// Room, the Password of private rooms and either Name or a session
+	// Token, to join under the name of an account. Ticket is the join
+	// ticket of the room, Room may be left out when a ticket is given. Sent
+	// back by the server it carries Version and only acknowledges the
+	// protocol version, see TypePresence.
+	TypeHello Type = "hello"
+	// TypeChat is a message. Sent by the client it carries Text and an
+	// optional Ref to be acknowledged, sent by the server it carries the
+	// Sender and Text. Chat frames without a Sender are notices of the room
+	// to all of its members. Replayed is set on the messages sent to the
+	// room before the client joined it, which the server sends right after
+	// the presence frame.
+	TypeChat Type = "chat"
+	// TypeSystem is a reply of the room to a single client, such as the
+	// result of a command, in Text.
+	TypeSystem Type = "system"
+	// TypeJoin and TypeLeave tell that the user called Name has joined or
+	// left the room.
+	TypeJoin  Type = "join"
+	TypeLeave Type = "leave"
+	// TypeError reports a request that failed. Code is the name of the gRPC
+	// status code of the failure and Text describes it.
+	TypeError Type = "error"
+	// TypeAck acknowledges the chat frame sent by the client with the same
+	// Ref. Its ID and Seq are the ones the message was sent to the room
+	// with, if any.
+	TypeAck Type = "ack"
+	// TypePresence lists the Members of the room. It is sent to a client
+	// when it joins and to everybody when somebody changes their name.
+	TypePresence Type = "presence"
+)
+
+// Frame is a single unit of the protocol. The meaning of the fields depends on
+// the frame's Type, fields that don't apply are left empty.
+//
+// Every frame sent by the server carries the Time it was sent at, in
+// milliseconds since the Unix epoch. Chat, join and leave frames, which are
+// sent to the whole room, also carry a unique ID and a Seq growing by one with
+// each of them, so clients can order them, drop duplicates and notice the
+// ones they have missed.
+type Frame struct {
+	Type     Type     `json:"type"`
+	Version  int      `json:"version,omitempty"`
+	Room     string   `json:"room,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	Password string   `json:"password,omitempty"`
+	Token    string   `json:"token,omitempty"`
+	Ticket   string   `json:"ticket,omitempty"`
+	Sender   string   `json:"sender,omitempty"`
+	Text     string   `json:"text,omitempty"`
+	Ref      string   `json:"ref,omitempty"`
+	Code     string   `json:"code,omitempty"`
+	Members  []string `json:"members,omitempty"`
+	Replayed bool     `json:"replayed,omitempty"`
+	ID       string   `json:"id,omitempty"`
+	Seq      uint64   `json:"seq,omitempty"`
+	Time     int64    `json:"time,omitempty"`
+}
+
+// ErrFrameTooLarge is returned by Reader.Read for a frame longer than
+// MaxFrameSize.
+var ErrFrameTooLarge = errors.New("frame is too large")
+
+// Parse decodes a single frame. Fields unknown to this version of the protocol
+// are ignored, unknown frame types are not.
+func Parse(line []byte) (*Frame, error) {
+	var f Frame
+	if err := json.Unmarshal(line, &f); err != nil {
+		return nil, fmt.Errorf("malformed frame: %s", err)
+	}
+	switch f.Type {
+	case TypeHello:
+		if f.Version <= 0 {
+			return nil, fmt.Errorf("hello frame without a protocol version")
+		}
+	case TypeChat, TypeSystem, TypeJoin, TypeLeave, TypeError, TypeAck, TypePresence:
+	case "":
+		return nil, fmt.Errorf("frame without a type")
+	default:
+		return nil, fmt.Errorf("unknown frame type \"%s\"", f.Type)
+	}
+	return &f, nil
+}
+
+// Write encodes f as a single line.
+func Write(w io.Writer, f *Frame) error {
+	line, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
+
+// Reader reads frames from a connection.
+type Reader struct {
+	input *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{input: bufio.NewReader(r)}
+}
+
+// Read returns the next frame. A frame that can't be parsed is reported with an
+// *InvalidFrameError, and one longer than MaxFrameSize with ErrFrameTooLarge.
+// The frames after them can still be read. Any other error is permanent.
+func (r *Reader) Read() (*Frame, error) {
+	line, err := ReadLine(r.input, MaxFrameSize)
+	if err != nil {
+		if errors.Is(err, ErrLineTooLong) {
+			return nil, ErrFrameTooLarge
+		}
+		return nil, err
+	}
+	f, err := Parse(line)
+	if err != nil {
+		return nil, &InvalidFrameError{Err: err}
+	}
+	return f, nil
+}
+
+var ErrLineTooLong = errors.New("line is too long")
+
+// ReadLine returns the next line of at most max bytes, including the line
+// ending, which is stripped. A longer line is skipped and reported with
+// ErrLineTooLong, so the lines after it can still be read. The last line
+// doesn't need a line ending.
+func ReadLine(r *bufio.Reader, max int) ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if !tooLong {
+			if len(line)+len(chunk) > max {
+				tooLong, line = true, nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil && (err != io.EOF || (len(line) == 0 && !tooLong)) {
+			return nil, err
+		}
+		if tooLong {
+			return nil, ErrLineTooLong
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		return bytes.TrimSuffix(line, []byte("\r")), nil
+	}
+}
+
+// InvalidFrameError is returned by Reader.Read for a frame that could not be
+// parsed.
+type InvalidFrameError struct {
+	Err error
+}
+
+func (e *InvalidFrameError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InvalidFrameError) Unwrap() error {
+	return e.Err
+}
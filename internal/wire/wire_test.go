@@ -0,0 +1,141 @@
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		line  string
+		frame *Frame
+	}{
+		{`{"type":"hello","version":1,"room":"r","name":"alice"}`, &Frame{Type: TypeHello, Version: 1, Room: "r", Name: "alice"}},
+		{`{"type":"chat","text":"hi","ref":"7"}`, &Frame{Type: TypeChat, Text: "hi", Ref: "7"}},
+		{`{"type":"presence","members":["a","b"],"future":true}`, &Frame{Type: TypePresence, Members: []string{"a", "b"}}},
+		{`{"type":"hello"}`, nil},
+		{`{"type":"shout","text":"hi"}`, nil},
+		{`{"text":"hi"}`, nil},
+		{`hi`, nil},
+		{``, nil},
+	}
+
+	for _, tc := range testCases {
+		f, err := Parse([]byte(tc.line))
+		if tc.frame == nil {
+			assert.Error(t, err, "line %q", tc.line)
+		} else {
+			assert.NoError(t, err, "line %q", tc.line)
+			assert.Equal(t, tc.frame, f, "line %q", tc.line)
+		}
+	}
+}
+
+func TestReader(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, &Frame{Type: TypeChat, Text: "multi\nline"}))
+	buf.WriteString("garbage\n")
+	require.NoError(t, Write(&buf, &Frame{Type: TypeLeave, Name: "bob"}))
+	buf.WriteString(`{"type":"chat","text":"` + strings.Repeat("a", MaxFrameSize) + "\"}\n")
+	buf.WriteString(`{"type":"chat","text":"after"}`)
+
+	r := NewReader(&buf)
+	f, err := r.Read()
+	require.NoError(t, err)
+	assert.Equal(t, "multi\nline", f.Text)
+
+	_, err = r.Read()
+	var invalid *InvalidFrameError
+	assert.True(t, errors.As(err, &invalid))
+
+	f, err = r.Read()
+	require.NoError(t, err)
+	assert.Equal(t, &Frame{Type: TypeLeave, Name: "bob"}, f)
+
+	_, err = r.Read()
+	assert.ErrorIs(t, err, ErrFrameTooLarge)
+
+	// frames after a frame that is too large can be read
+	f, err = r.Read()
+	require.NoError(t, err)
+	assert.Equal(t, &Frame{Type: TypeChat, Text: "after"}, f)
+	_, err = r.Read()
+	assert.ErrorIs(t, err, io.EOF)
+
+	_, err = NewReader(strings.NewReader("")).Read()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestReadLine(t *testing.T) {
+	input := "one\r\n" + strings.Repeat("x", 40) + "\n\ntwo\nthree" + strings.Repeat("y", 20)
+	r := bufio.NewReaderSize(strings.NewReader(input), 16)
+	for _, want := range []struct {
+		line    string
+		tooLong bool
+	}{{"one", false}, {"", true}, {"", false}, {"two", false}, {"", true}} {
+		line, err := ReadLine(r, 10)
+		if want.tooLong {
+			assert.ErrorIs(t, err, ErrLineTooLong)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, want.line, string(line))
+	}
+	_, err := ReadLine(r, 10)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func FuzzParse(f *testing.F) {
+	f.Add([]byte(`{"type":"hello","version":1,"room":"r","name":"alice","password":"p"}`))
+	f.Add([]byte(`{"type":"hello","version":1,"token":"payload.signature","ticket":"r.secret"}`))
+	f.Add([]byte(`{"type":"chat","sender":"bob","text":"hi","id":"r-1","seq":1,"time":1760000000000}`))
+	f.Add([]byte(`{"type":"ack","ref":"1","seq":18446744073709551615,"time":-1}`))
+	f.Add([]byte(`{"type":"error","code":"NotFound","text":"no such room"}`))
+	f.Add([]byte(`{"type":"presence","members":["a","b"]}`))
+	f.Add([]byte(`{"type":"ack","ref":"é"}`))
+	f.Add([]byte(`{"type":"chat","text":"\ud800"}`))
+	f.Add([]byte(`[]`))
+
+	f.Fuzz(func(t *testing.T, line []byte) {
+		frame, err := Parse(line)
+		if err != nil {
+			return
+		}
+		// a parsed frame must survive a round trip on a single line
+		var buf bytes.Buffer
+		if err := Write(&buf, frame); err != nil {
+			t.Fatalf("can't write parsed frame %+v: %s", frame, err)
+		}
+		if n := bytes.Count(buf.Bytes(), []byte("\n")); n != 1 {
+			t.Fatalf("frame %+v was written on %d lines", frame, n)
+		}
+		again, err := NewReader(&buf).Read()
+		if err != nil && !errors.Is(err, ErrFrameTooLarge) {
+			t.Fatalf("can't read written frame %q: %s", buf.String(), err)
+		}
+		if err == nil && !equalFrames(frame, again) {
+			t.Fatalf("frame changed in a round trip: %+v became %+v", frame, again)
+		}
+	})
+}
+
+// equalFrames compares every field of a and b, empty and missing member lists
+// alike, as JSON doesn't tell them apart.
+func equalFrames(a, b *Frame) bool {
+	x, y := *a, *b
+	if len(x.Members) == 0 {
+		x.Members = nil
+	}
+	if len(y.Members) == 0 {
+		y.Members = nil
+	}
+	return reflect.DeepEqual(x, y)
+}